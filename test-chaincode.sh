@@ -0,0 +1,26 @@
+#!/bin/bash
+#
+# Copyright IBM Corp. All Rights Reserved.
+#
+# SPDX-License-Identifier: Apache-2.0
+#
+
+#
+# This script builds, vets and tests the chaincode in the fabric-ccenv image
+# the peers build it in. The image provides the shim, its MockStub and the
+# protos at the versions the network runs, laid out in GOPATH the same way
+# as for "peer chaincode install -p github.com/".
+#
+
+set -e
+
+SDIR=$(cd "$(dirname "$0")" && pwd)
+
+# Same release as the fabric-ca images pulled by bootstrap.sh
+CCENV_TAG=${1:-1.2.0}
+
+docker run --rm \
+   -v ${SDIR}/votechaincode/:/chaincode/input/src/github.com/ \
+   -w /chaincode/input/src/github.com \
+   hyperledger/fabric-ccenv:${CCENV_TAG} \
+   /bin/bash -c 'export GOPATH=/chaincode/input:$GOPATH && go build . && go vet . && go test -v .'
@@ -0,0 +1,51 @@
+package main
+
+// approvalMethod lets voters approve any number of candidates within the
+// selection limits of the contest. The candidates with the most approvals
+// win.
+type approvalMethod struct{}
+
+func (approvalMethod) validateRules(rules *ContestRules, field string, verr *ValidationError) {
+	validateSelectionLimits(rules, field, verr)
+	rejectSeats(rules, field, verr)
+	if rules.MaxSelections > 0 && rules.WriteIns > rules.MaxSelections {
+		verr.add(field+"writeIns", "must not exceed maxSelections")
+	}
+}
+
+func (approvalMethod) validateBallot(rules *ContestRules, ballot *Ballot) error {
+	err := ballot.expectFields("approvals", "writeIns")
+	if err != nil {
+		return err
+	}
+	err = validateCandidateList(rules, ballot.Approvals, "approvals")
+	if err != nil {
+		return err
+	}
+	err = validateWriteIns(rules, ballot.WriteIns)
+	if err != nil {
+		return err
+	}
+	return checkSelections(rules, len(ballot.Approvals)+len(ballot.WriteIns))
+}
+
+func (approvalMethod) counters(ballot *Ballot) *Counters {
+	counters := newCounters()
+	counters.Ballots = 1
+	for _, candidateID := range ballot.Approvals {
+		counters.Candidates[candidateID] = 1
+	}
+	return counters
+}
+
+func (approvalMethod) tally(electionData *ElectionData, rules *ContestRules, ballots []*Ballot, tally *ContestTally) {
+	totals := newTotals(rules)
+	for _, ballot := range ballots {
+		for _, candidateID := range ballot.Approvals {
+			index := rules.candidateIndex(candidateID)
+			totals[index].Marks += ballot.weight()
+			totals[index].Total += ballot.weight()
+		}
+	}
+	finishTotals(totals, totalWeight(ballots), tally)
+}
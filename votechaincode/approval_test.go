@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApprovalVoting(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	voter := newVoter(t, "voter")
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, `"votingMethod":"approval","minSelections":1,"maxSelections":2,`+
+		`"candidates":[{"id":"a","name":"A"},{"id":"b","name":"B"},{"id":"c","name":"C"}],"endCondition":{"type":"TimeOnlyCondition"}`))
+	ballots := map[string]string{
+		`{"approvals":[]}`:            "at least 1 candidates must be selected",
+		`{"approvals":["a","b","c"]}`: "at most 2 candidates may be selected",
+		`{"approvals":["a","a"]}`:     `candidate "a" listed more than once in approvals`,
+		`{"approvals":["d"]}`:         `unknown candidate "d" in approvals`,
+		`{"candidate":"a"}`:           "candidate not allowed, expecting approvals or writeIns",
+	}
+	for ballot, message := range ballots {
+		stub.expectError(t, message, voter, "voteInvokation", "e", ballot)
+	}
+	castBallots(t, stub, "e", `{"approvals":["a","b"]}`, `{"approvals":["a"]}`, `{"approvals":["b","c"]}`)
+	setClock(frozen, testEndDate+1)
+
+	tally := queryTally(t, stub, admin, "e")
+	expected := []CandidateTotal{{"a", 2, 2, 2.0 / 3}, {"b", 2, 2, 2.0 / 3}, {"c", 1, 1, 1.0 / 3}}
+	if !reflect.DeepEqual(tally.Totals, expected) {
+		t.Errorf("totals %+v, expected %+v", tally.Totals, expected)
+	}
+	if !reflect.DeepEqual(tally.Winners, []string{"a", "b"}) {
+		t.Errorf("winners %v, expected a and b", tally.Winners)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const archiveObjectType = "archive"
+
+// ArchiveRecord is written by destructionInvokation before the live state of
+// an election is deleted. It is sealed by the ElectionReset event.
+type ArchiveRecord struct {
+	ElectionID   string       `json:"electionID"`
+	ElectionData ElectionData `json:"electionData"`
+	Lifecycle    Lifecycle    `json:"lifecycle"`
+	ArchivedBy   string       `json:"archivedBy"`
+	ArchivedAt   int64        `json:"archivedAt"`
+	TxID         string       `json:"txID"`
+	BallotCount  int          `json:"ballotCount"`
+	Tally        Tally        `json:"tally"`
+	BallotHashes []string     `json:"ballotHashes"`
+	// Spoiled lists the ballots spoiled by an admin. Their hashes are still
+	// part of BallotHashes.
+	Spoiled []SpoiledBallot `json:"spoiled,omitempty"`
+	// WriteInMappings are the final write-in mappings of the contests.
+	WriteInMappings []WriteInMapping `json:"writeInMappings,omitempty"`
+	// Commitments are the sorted commitments of a commit–reveal election.
+	Commitments []string `json:"commitments,omitempty"`
+	// EncryptedTally and DecryptionShares let anyone re-verify the
+	// decryption of an encrypted election.
+	EncryptedTally   *EncryptedTally   `json:"encryptedTally,omitempty"`
+	DecryptionShares []DecryptionShare `json:"decryptionShares,omitempty"`
+	// KeyCeremony is the transcript the election key was generated with.
+	KeyCeremony *KeyCeremonyTranscript `json:"keyCeremony,omitempty"`
+}
+
+// ResetEvent is the payload of the ElectionReset chaincode event. Seal is
+// the hex encoded SHA-256 of the archive record as stored under ArchiveKey.
+// The event is committed in the block of the reset transaction rather than
+// in the world state, so it can't be changed together with the record: a
+// record altered by a later transaction, e.g. of an upgraded chaincode, no
+// longer matches the seal of the event of its TxID. It doesn't protect
+// against a reset that archived wrong data in the first place, that is up
+// to the endorsement policy.
+type ResetEvent struct {
+	ElectionID  string `json:"electionID"`
+	Admin       string `json:"admin"`
+	ArchiveKey  string `json:"archiveKey"`
+	BallotCount int    `json:"ballotCount"`
+	Seal        string `json:"seal"`
+}
+
+// archiveKey is the key of the archive record an election reset in txID.
+// An election ID can be reused after a reset, so every reset gets its own
+// record.
+func archiveKey(stub shim.ChaincodeStubInterface, electionID, txID string) (string, error) {
+	return stub.CreateCompositeKey(archiveObjectType, []string{electionID, txID})
+}
+
+// assertVisible returns an error if the caller may not see the tally and
+// ballot hashes of the record yet. They are visible like the results of the
+// election in the state it was reset from.
+func (a *ArchiveRecord) assertVisible(stub shim.ChaincodeStubInterface) error {
+	lifecycle := a.Lifecycle
+	if len(lifecycle.History) > 0 {
+		lifecycle.State = lifecycle.History[len(lifecycle.History)-1].From
+	}
+	if !lifecycle.hasStarted() {
+		return nil
+	}
+	return assertResultsVisible(stub, &a.ElectionData, &lifecycle)
+}
+
+// sealArchive returns the seal of an archive record as stored.
+func sealArchive(recordJson []byte) string {
+	sum := sha256.Sum256(recordJson)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashBallot returns the hex encoded SHA-256 of a stored ballot.
+func hashBallot(ballot []byte) string {
+	sum := sha256.Sum256(ballot)
+	return hex.EncodeToString(sum[:])
+}
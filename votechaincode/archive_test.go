@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestResetArchivesAndSealsElection(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	electionJson := testElectionJson(10, `"candidates":[{"id":"a","name":"A"},{"id":"b","name":"B"}],"endCondition":{"type":"TimeOnlyCondition"}`)
+
+	openElection(t, stub, frozen, admin, "e", electionJson)
+	stub.mustInvoke(t, newVoter(t, "v1"), "voteInvokation", "e", `{"candidate":"a"}`)
+	stub.mustInvoke(t, newVoter(t, "v2"), "voteInvokation", "e", `{"candidate":"a"}`)
+	stub.mustInvoke(t, admin, "transitionElection", "e", string(StateClosed))
+	stub.expectError(t, "User isn't admin", newVoter(t, "v3"), "destructionInvokation", "e")
+	stub.mustInvoke(t, admin, "destructionInvokation", "e")
+
+	var event ResetEvent
+	err := json.Unmarshal(stub.events["ElectionReset"], &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ElectionID != "e" || event.Admin != admin.ID || event.BallotCount != 2 {
+		t.Errorf("unexpected reset event %+v", event)
+	}
+	stored := stub.State[event.ArchiveKey]
+	if stored == nil {
+		t.Fatal("no archive record under the key of the event")
+	}
+	if sealArchive(stored) != event.Seal {
+		t.Error("seal of the event doesn't match the stored record")
+	}
+
+	var records []ArchiveRecord
+	err = json.Unmarshal(stub.mustInvoke(t, admin, "archivesQuery", "e"), &records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("%d archive records, expected 1", len(records))
+	}
+	record := records[0]
+	if record.BallotCount != 2 || len(record.BallotHashes) != 2 || record.Tally.Results[0].Votes != 2 {
+		t.Errorf("unexpected archive record %+v", record)
+	}
+	if record.Lifecycle.State != StateArchived {
+		t.Errorf("archived lifecycle is %s", record.Lifecycle.State)
+	}
+	// Clients verify the records of archivesQuery against the seal.
+	recordJson, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealArchive(recordJson) != event.Seal {
+		t.Error("record of archivesQuery doesn't match the seal")
+	}
+	record.BallotCount = 1
+	recordJson, err = json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealArchive(recordJson) == event.Seal {
+		t.Error("altered record matches the seal")
+	}
+
+	// Only the archive is left and the election ID can be used again.
+	for key := range stub.State {
+		if key != event.ArchiveKey {
+			t.Errorf("key %q left after the reset", key)
+		}
+	}
+	if string(stub.mustInvoke(t, admin, "initStatusQuery", "e")) != "false" {
+		t.Error("election still initialized after the reset")
+	}
+	setClock(frozen, testStartDate-60)
+	scheduleElection(t, stub, admin, "e", electionJson)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Ballot is the vote a voter submits with voteInvokation. Which fields are
+// used depends on the votingMethod of the contest. Candidate, Ranking,
+// Approvals and the keys of Scores are IDs of candidates in the contest's
+// registry. WriteIns are free text names of candidates in the write-in slots
+// of the contest. Choice answers a referendum. Encrypted maps every candidate
+// of a contest in an encrypted election to an encrypted 0 or 1. Proofs holds
+// the proof of that for every candidate and SumProof proves that the sum of
+// the ciphertexts is within the selection limits of the contest. Blank answers
+// a contest without choosing anything and may not be combined with other
+// fields. In elections with contests the ballot only sets Contests, which
+// maps every contest ID to the answer to that contest.
+type Ballot struct {
+	Candidate string                      `json:"candidate,omitempty"`
+	Ranking   []string                    `json:"ranking,omitempty"`
+	Approvals []string                    `json:"approvals,omitempty"`
+	Scores    map[string]int              `json:"scores,omitempty"`
+	WriteIns  []string                    `json:"writeIns,omitempty"`
+	Choice    string                      `json:"choice,omitempty"`
+	Encrypted map[string]Ciphertext       `json:"encrypted,omitempty"`
+	Proofs    map[string]DisjunctiveProof `json:"proofs,omitempty"`
+	SumProof  DisjunctiveProof            `json:"sumProof,omitempty"`
+	Blank     bool                        `json:"blank,omitempty"`
+	Contests  map[string]*Ballot          `json:"contests,omitempty"`
+
+	// Org is the MSP ID and Weight the voting weight of the voter. Both are
+	// recorded by voteInvokation and inherited by the answers to contests.
+	Org    string `json:"org,omitempty"`
+	Weight int    `json:"weight,omitempty"`
+}
+
+// parseBallot strictly decodes a ballot and checks it against the voting
+// methods and candidate registries of the election.
+func parseBallot(data []byte, electionData *ElectionData) (*Ballot, error) {
+	var ballot Ballot
+	err := decodeStrict(data, &ballot)
+	if err != nil {
+		return nil, errors.New("Invalid ballot: " + err.Error())
+	}
+	if ballot.Org != "" || ballot.Weight != 0 {
+		return nil, errors.New("Invalid ballot: org and weight are recorded by the chaincode")
+	}
+	err = electionData.validateBallot(&ballot)
+	if err != nil {
+		return nil, errors.New("Invalid ballot: " + err.Error())
+	}
+	return &ballot, nil
+}
+
+// validateBallot checks that a ballot answers every contest of the election
+// validly and nothing else. A ballot is only valid as a whole.
+func (e *ElectionData) validateBallot(ballot *Ballot) error {
+	if len(e.Contests) > 0 {
+		err := ballot.expectFields("contests")
+		if err != nil {
+			return err
+		}
+		// Sorted so that every peer reports the same error.
+		contestIDs := make([]string, 0, len(ballot.Contests))
+		for contestID := range ballot.Contests {
+			contestIDs = append(contestIDs, contestID)
+		}
+		sort.Strings(contestIDs)
+		for _, contestID := range contestIDs {
+			if e.contestIndex(contestID) == -1 {
+				return errors.New("unknown contest \"" + contestID + "\"")
+			}
+		}
+	}
+
+	for _, contest := range e.contests() {
+		answer := ballot.answer(contest)
+		if answer == nil {
+			return errors.New("no answer for contest \"" + contest.ID + "\"")
+		}
+		if answer.Blank {
+			err := answer.expectFields("blank")
+			if err != nil && contest.ID != "" {
+				return errors.New("contest \"" + contest.ID + "\": " + err.Error())
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		method, err := contest.votingMethod()
+		if err != nil {
+			return err
+		}
+		if e.Encryption != nil {
+			err = validateEncryptedAnswer(&contest.ContestRules, answer)
+		} else {
+			err = method.validateBallot(&contest.ContestRules, answer)
+		}
+		if err != nil && contest.ID != "" {
+			return errors.New("contest \"" + contest.ID + "\": " + err.Error())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// answer returns the part of the ballot that answers contest.
+func (b *Ballot) answer(contest *Contest) *Ballot {
+	if contest.ID == "" {
+		return b
+	}
+	answer := b.Contests[contest.ID]
+	if answer != nil {
+		answer.Org = b.Org
+		answer.Weight = b.Weight
+	}
+	return answer
+}
+
+// expectFields returns an error if the ballot sets a field other than the
+// allowed ones, given by their JSON names.
+func (b *Ballot) expectFields(allowed ...string) error {
+	set := map[string]bool{
+		"candidate": b.Candidate != "",
+		"ranking":   len(b.Ranking) != 0,
+		"approvals": len(b.Approvals) != 0,
+		"scores":    len(b.Scores) != 0,
+		"writeIns":  len(b.WriteIns) != 0,
+		"choice":    b.Choice != "",
+		"encrypted": len(b.Encrypted) != 0,
+		"proofs":    len(b.Proofs) != 0,
+		"sumProof":  len(b.SumProof) != 0,
+		"blank":     b.Blank,
+		"contests":  len(b.Contests) != 0,
+	}
+	for _, field := range allowed {
+		delete(set, field)
+	}
+	for _, field := range []string{"candidate", "ranking", "approvals", "scores", "writeIns", "choice", "encrypted", "proofs", "sumProof", "blank", "contests"} {
+		if set[field] {
+			return errors.New(field + " not allowed, expecting " + strings.Join(allowed, " or "))
+		}
+	}
+	return nil
+}
+
+// isBlank reports whether the ballot answers every contest blank.
+func (b *Ballot) isBlank(electionData *ElectionData) bool {
+	for _, contest := range electionData.contests() {
+		if !b.answer(contest).Blank {
+			return false
+		}
+	}
+	return true
+}
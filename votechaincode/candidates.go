@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// getEditableElection loads an election whose candidate registry may still
+// be changed, i.e. an admin is calling and voting hasn't started yet.
+func getEditableElection(stub shim.ChaincodeStubInterface, electionID string) (*ElectionData, error) {
+	err := cid.AssertAttributeValue(stub, "admin", "true")
+	if err != nil {
+		return nil, errors.New("User isn't admin")
+	}
+	electionData, lifecycle, err := getElection(stub, electionID)
+	if err != nil {
+		return nil, err
+	}
+	if lifecycle.hasStarted() {
+		return nil, errors.New("Election can only be changed before it starts")
+	}
+	return electionData, nil
+}
+
+// getEditableContest loads the editable election named by args[0] and the
+// rules of its contest named by the optional args[2].
+func getEditableContest(stub shim.ChaincodeStubInterface, args []string) (*ElectionData, *ContestRules, error) {
+	electionData, err := getEditableElection(stub, args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	contestID := ""
+	if len(args) == 3 {
+		contestID = args[2]
+	}
+	rules, err := electionData.contestRules(contestID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return electionData, rules, nil
+}
+
+// updateCandidates validates the changed candidate registry and writes it
+// back to the ledger.
+func updateCandidates(stub shim.ChaincodeStubInterface, electionID string, electionData *ElectionData) error {
+	verr := electionData.validate()
+	if verr != nil {
+		return verr
+	}
+	return putElectionData(stub, electionID, electionData)
+}
+
+// Add a candidate to an election. Expects the election ID, a JSON Candidate
+// and for elections with contests the contest ID. Without an id one is
+// derived from the name. Returns the stored Candidate.
+func (t *VoteChaincode) addCandidate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID, a JSON string representing a Candidate and optionally the contest ID")
+	}
+	electionID := args[0]
+	electionData, rules, err := getEditableContest(stub, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var candidate Candidate
+	err = decodeStrict([]byte(args[1]), &candidate)
+	if err != nil {
+		return shim.Error("Candidate couldn't be parsed: " + err.Error())
+	}
+	if candidate.ID == "" {
+		candidate.ID = rules.newCandidateID(candidate.Name)
+	}
+	rules.Candidates = append(rules.Candidates, candidate)
+
+	err = updateCandidates(stub, electionID, electionData)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("Candidate " + candidate.ID + " added to election " + electionID)
+	candidateJson, err := json.Marshal(candidate)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	return shim.Success(candidateJson)
+}
+
+// Change name and description of a candidate. Expects the election ID, a
+// JSON Candidate whose id names the candidate to update and for elections
+// with contests the contest ID.
+func (t *VoteChaincode) updateCandidate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID, a JSON string representing a Candidate and optionally the contest ID")
+	}
+	electionID := args[0]
+	electionData, rules, err := getEditableContest(stub, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var candidate Candidate
+	err = decodeStrict([]byte(args[1]), &candidate)
+	if err != nil {
+		return shim.Error("Candidate couldn't be parsed: " + err.Error())
+	}
+	index := rules.candidateIndex(candidate.ID)
+	if index == -1 {
+		return shim.Error("Unknown candidate \"" + candidate.ID + "\"")
+	}
+	rules.Candidates[index] = candidate
+
+	err = updateCandidates(stub, electionID, electionData)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("Candidate " + candidate.ID + " of election " + electionID + " updated")
+	candidateJson, err := json.Marshal(candidate)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	return shim.Success(candidateJson)
+}
+
+// Remove a candidate from an election. Expects the election ID, the
+// candidate ID and for elections with contests the contest ID.
+func (t *VoteChaincode) removeCandidate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID, the candidate ID and optionally the contest ID")
+	}
+	electionID := args[0]
+	electionData, rules, err := getEditableContest(stub, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	index := rules.candidateIndex(args[1])
+	if index == -1 {
+		return shim.Error("Unknown candidate \"" + args[1] + "\"")
+	}
+	rules.Candidates = append(rules.Candidates[:index], rules.Candidates[index+1:]...)
+
+	err = updateCandidates(stub, electionID, electionData)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("Candidate " + args[1] + " removed from election " + electionID)
+	return shim.Success(nil)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCandidateRegistry(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	voter := newVoter(t, "voter")
+
+	stub.mustInvoke(t, admin, "initializationInvokation", "e", testElectionJson(10, lifecycleTestElection))
+	stub.expectError(t, "User isn't admin", voter, "addCandidate", "e", `{"name":"Bob"}`)
+
+	var added Candidate
+	err := json.Unmarshal(stub.mustInvoke(t, admin, "addCandidate", "e", `{"name":"Alice Smith"}`), &added)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.ID != "alice-smith" {
+		t.Errorf("candidate ID %q, expected alice-smith", added.ID)
+	}
+	stub.expectError(t, "duplicates candidates[1]", admin, "addCandidate", "e", `{"name":"alice smith "}`)
+	stub.expectError(t, "Candidate couldn't be parsed", admin, "addCandidate", "e", `{"name":"Bob","party":"x"}`)
+	stub.mustInvoke(t, admin, "updateCandidate", "e", `{"id":"alice-smith","name":"Alice Smith","description":"Mayor"}`)
+	stub.expectError(t, `Unknown candidate "bob"`, admin, "updateCandidate", "e", `{"id":"bob","name":"Bob"}`)
+	stub.mustInvoke(t, admin, "addCandidate", "e", `{"id":"bob","name":"Bob"}`)
+	stub.mustInvoke(t, admin, "removeCandidate", "e", "a")
+	stub.expectError(t, `Unknown candidate "a"`, admin, "removeCandidate", "e", "a")
+
+	var electionData ElectionData
+	err = json.Unmarshal(stub.mustInvoke(t, voter, "electionDataQuery", "e"), &electionData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Candidate{{ID: "alice-smith", Name: "Alice Smith", Description: "Mayor"}, {ID: "bob", Name: "Bob"}}
+	if len(electionData.Candidates) != len(expected) || electionData.Candidates[0] != expected[0] || electionData.Candidates[1] != expected[1] {
+		t.Errorf("candidates %+v, expected %+v", electionData.Candidates, expected)
+	}
+
+	stub.mustInvoke(t, admin, "transitionElection", "e", string(StateScheduled))
+	stub.mustInvoke(t, admin, "addCandidate", "e", `{"name":"Carol"}`)
+	setClock(frozen, testStartDate+1)
+	stub.expectError(t, "Election can only be changed before it starts", admin, "addCandidate", "e", `{"name":"Dave"}`)
+	stub.expectError(t, "Election can only be changed before it starts", admin, "removeCandidate", "e", "bob")
+	stub.mustInvoke(t, voter, "voteInvokation", "e", `{"candidate":"carol"}`)
+}
+
+func TestVoteRejectsInvalidBallots(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	voter := newVoter(t, "voter")
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, `"candidates":[{"id":"a","name":"A"},{"id":"b","name":"B"}],"endCondition":{"type":"TimeOnlyCondition"}`))
+	ballots := map[string]string{
+		`A`:                                 "Invalid ballot: invalid character",
+		``:                                  "Invalid ballot: EOF",
+		`{}`:                                "Invalid ballot: no candidate given",
+		`{"candidate":""}`:                  "Invalid ballot: no candidate given",
+		`{"candidate":"c"}`:                 `Invalid ballot: unknown candidate "c"`,
+		`{"candidate":"A"}`:                 `Invalid ballot: unknown candidate "A"`,
+		`{"candidate":"a","extra":1}`:       `Invalid ballot: json: unknown field "extra"`,
+		`{"candidate":"a"} x`:               "Invalid ballot: unexpected data after JSON value",
+		`{"candidate":"a","ranking":["a"]}`: "Invalid ballot: ranking not allowed",
+		`{"candidate":"a","org":"x"}`:       "Invalid ballot: org and weight are recorded by the chaincode",
+	}
+	for ballot, message := range ballots {
+		stub.expectError(t, message, voter, "voteInvokation", "e", ballot)
+	}
+	if stub.mustInvoke(t, voter, "ownVoteQuery", "e") != nil {
+		t.Fatal("invalid ballot was stored")
+	}
+	stub.mustInvoke(t, voter, "voteInvokation", "e", `{"candidate":"b"}`)
+	stub.expectError(t, "User is admin therefore is not allowed to vote", admin, "voteInvokation", "e", `{"candidate":"b"}`)
+}
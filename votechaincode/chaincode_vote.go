@@ -7,8 +7,7 @@ import (
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
 	"encoding/json"
-	"strconv"
-	"time"
+	"sort"
 )
 
 type VoteChaincode struct {
@@ -23,7 +22,7 @@ func (t *VoteChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	fmt.Println("Vote Invoke")
 	function, args := stub.GetFunctionAndParameters()
 	if function == "allVotesQuery" {
-		// Retrieve all submitted votes.
+		// Retrieve all submitted votes once the election has closed.
 		return t.allVotesQuery(stub, args)
 	} else if function == "electionStatusQuery" {
 		// Check if election has ended.
@@ -35,10 +34,10 @@ func (t *VoteChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 		// Retrieve metadata about the election.
 		return t.electionDataQuery(stub, args)
 	} else if function == "destructionInvokation" {
-		// Clears the current election.
+		// Archives and clears an election.
 		return t.destructionInvokation(stub, args)
 	} else if function == "initializationInvokation" {
-		// Initializes the election with metadata.
+		// Initializes a Draft election with metadata.
 		return t.initializationInvokation(stub, args)
 	} else if function == "voteInvokation" {
 		// Submits vote to chaincode.
@@ -46,6 +45,99 @@ func (t *VoteChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	} else if function == "initStatusQuery" {
 		//Check if an election is initialized
 		return t.initStatusQuery(stub, args)
+	} else if function == "listElectionsQuery" {
+		// Retrieve all initialized elections.
+		return t.listElectionsQuery(stub, args)
+	} else if function == "transitionElection" {
+		// Moves an election to another lifecycle state.
+		return t.transitionElection(stub, args)
+	} else if function == "pauseElection" {
+		// Stops voting until the election is resumed.
+		return t.pauseElection(stub, args)
+	} else if function == "resumeElection" {
+		// Reopens a paused election.
+		return t.resumeElection(stub, args)
+	} else if function == "addCandidate" {
+		// Adds a candidate before the election starts.
+		return t.addCandidate(stub, args)
+	} else if function == "updateCandidate" {
+		// Renames or redescribes a candidate before the election starts.
+		return t.updateCandidate(stub, args)
+	} else if function == "removeCandidate" {
+		// Removes a candidate before the election starts.
+		return t.removeCandidate(stub, args)
+	} else if function == "tallyQuery" {
+		// Retrieve the per candidate result once the election has closed.
+		return t.tallyQuery(stub, args)
+	} else if function == "turnoutQuery" {
+		// Retrieve the number of submitted votes.
+		return t.turnoutQuery(stub, args)
+	} else if function == "evaluateEndCondition" {
+		// Closes the election if its end condition is reached.
+		return t.evaluateEndCondition(stub, args)
+	} else if function == "requestManualClose" {
+		// Reaches ManualCloseCondition of an election.
+		return t.requestManualClose(stub, args)
+	} else if function == "instantRunoffQuery" {
+		// Retrieve the rounds of an instant-runoff tally.
+		return t.instantRunoffQuery(stub, args)
+	} else if function == "schulzeQuery" {
+		// Retrieve the matrices and ranking of a Schulze tally.
+		return t.schulzeQuery(stub, args)
+	} else if function == "stvQuery" {
+		// Retrieve the stage by stage report of an STV tally.
+		return t.stvQuery(stub, args)
+	} else if function == "setVoterWeights" {
+		// Uploads the weight table of an election before it starts.
+		return t.setVoterWeights(stub, args)
+	} else if function == "spoilBallot" {
+		// Marks a ballot as spoiled so the tally skips it.
+		return t.spoilBallot(stub, args)
+	} else if function == "spoiledBallotsQuery" {
+		// Lists the spoiled ballots of an election.
+		return t.spoiledBallotsQuery(stub, args)
+	} else if function == "mapWriteIns" {
+		// Maps the write-ins of a closed election to candidates.
+		return t.mapWriteIns(stub, args)
+	} else if function == "writeInMappingQuery" {
+		// Retrieve the write-in mapping of a contest.
+		return t.writeInMappingQuery(stub, args)
+	} else if function == "revealVote" {
+		// Opens the commitment of a commit-reveal ballot.
+		return t.revealVote(stub, args)
+	} else if function == "commitmentsQuery" {
+		// Lists the commitments of a commit-reveal election.
+		return t.commitmentsQuery(stub, args)
+	} else if function == "submitDecryptionShare" {
+		// Submits the partial decryption of a trustee.
+		return t.submitDecryptionShare(stub, args)
+	} else if function == "decryptTally" {
+		// Combines the partial decryptions into the final counts.
+		return t.decryptTally(stub, args)
+	} else if function == "encryptedTallyQuery" {
+		// Retrieve the encrypted tally and the partial decryptions.
+		return t.encryptedTallyQuery(stub, args)
+	} else if function == "registerTrustee" {
+		// Registers the share encryption key of a trustee.
+		return t.registerTrustee(stub, args)
+	} else if function == "publishCommitments" {
+		// Publishes the Feldman commitments of a trustee.
+		return t.publishCommitments(stub, args)
+	} else if function == "dealShares" {
+		// Deals the encrypted shares of a trustee.
+		return t.dealShares(stub, args)
+	} else if function == "fileComplaint" {
+		// Disqualifies a dealer that sent a bad share.
+		return t.fileComplaint(stub, args)
+	} else if function == "finishKeyCeremony" {
+		// Derives the joint public key of the trustees.
+		return t.finishKeyCeremony(stub, args)
+	} else if function == "keyCeremonyQuery" {
+		// Retrieve the transcript of the key ceremony.
+		return t.keyCeremonyQuery(stub, args)
+	} else if function == "archivesQuery" {
+		// Retrieve the archive records of reset elections.
+		return t.archivesQuery(stub, args)
 	}
 
 	return shim.Error("Invalid invoke function name. Expecting \"vote\" \"query\"")
@@ -54,7 +146,18 @@ func (t *VoteChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 func (t *VoteChaincode) allVotesQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var resultSlice []string = []string{}
 
-	stateIterator, err := stub.GetStateByRange("v", "w")
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID")
+	}
+	electionData, lifecycle, err := getElection(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = assertResultsVisible(stub, electionData, lifecycle)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stateIterator, err := votesIterator(stub, args[0])
 	if err != nil {
 		return shim.Error("Failed to get StateIterator")
 	}
@@ -65,7 +168,11 @@ func (t *VoteChaincode) allVotesQuery(stub shim.ChaincodeStubInterface, args []s
 		if err != nil {
 			return shim.Error("StateIterator failed to retrieve next Element")
 		}
-		resultSlice = append(resultSlice, string(queryResponse.Value))
+		ballotBytes, err := readBallot(stub, electionData, queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		resultSlice = append(resultSlice, string(ballotBytes))
 	}
 
 	returnJson, err := json.Marshal(resultSlice)
@@ -75,194 +182,611 @@ func (t *VoteChaincode) allVotesQuery(stub shim.ChaincodeStubInterface, args []s
 	return shim.Success(returnJson)
 }
 
-func electionStartedEndedCheck(stub shim.ChaincodeStubInterface) (started,ended bool,err error) {
-	var initMap map[string]*json.RawMessage
-	var endConditionMap map[string]*json.RawMessage
-
-	//Retrieve Metadata from init Block
-	stateBytes, err := stub.GetState("init")
+// getElectionData loads the ElectionData of an election.
+func getElectionData(stub shim.ChaincodeStubInterface, electionID string) (*ElectionData, error) {
+	key, err := initKey(stub, electionID)
 	if err != nil {
-		return false,false,errors.New("Failed to get state")
+		return nil, err
+	}
+	stateBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get state")
 	}
 	if stateBytes == nil {
-		return false,false, errors.New("Init not set")
+		return nil, errors.New("Init not set")
 	}
 
-	err = json.Unmarshal(stateBytes, &initMap)
+	var electionData ElectionData
+	err = json.Unmarshal(stateBytes, &electionData)
 	if err != nil {
-		return false, false, errors.New("Json couldn't be parsed, maybe the initialization was done incorrectly.")
+		return nil, errors.New("Stored ElectionData couldn't be parsed")
 	}
+	return &electionData, nil
+}
 
-	err = json.Unmarshal([]byte(*initMap["endCondition"]), &endConditionMap)
+// putElectionData overwrites the stored ElectionData of an election.
+func putElectionData(stub shim.ChaincodeStubInterface, electionID string, electionData *ElectionData) error {
+	key, err := initKey(stub, electionID)
 	if err != nil {
-		return false,false, errors.New("Json of endCondition couldn't be parsed, maybe the initialization was done incorrectly.")
+		return err
 	}
+	initJson, err := json.Marshal(electionData)
+	if err != nil {
+		return errors.New("Failed to generate Json")
+	}
+	return stub.PutState(key, initJson)
+}
 
-	//Check Time for all electionEndTypes
-	endTimeInt, err := strconv.ParseInt(string(*initMap["endDate"]), 10, 64)
+// Fold the vote counters of an election and close it if its end condition
+// is reached. Votes close the election themselves, so admins only need this
+// to fold the deltas of elections whose condition doesn't read them. Its
+// range read of the deltas makes it fail validation if a vote of the same
+// block precedes it, which is why it is restricted to admins.
+func (t *VoteChaincode) evaluateEndCondition(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err := cid.AssertAttributeValue(stub,"admin","true")
+	if err != nil {
+		return shim.Error("User isn't admin")
+	}
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID")
+	}
+	electionID := args[0]
+	electionData, lifecycle, err := getElection(stub, electionID)
 	if err != nil {
-		return false,false, errors.New("endDate couldn't be parsed correctly, maybe the initialization was done incorrectly.")
+		return shim.Error(err.Error())
 	}
-	startTimeInt, err := strconv.ParseInt(string(*initMap["startDate"]), 10, 64)
+	err = closeIfEndConditionReached(stub, electionID, electionData, lifecycle)
 	if err != nil {
-		return false,false, errors.New("startDate couldn't be parsed correctly, maybe the initialization was done incorrectly.")
+		return shim.Error(err.Error())
 	}
+	return shim.Success([]byte(lifecycle.State))
+}
 
-	startTime := time.Unix(startTimeInt, 0)
-	endTime := time.Unix(endTimeInt, 0)
-	now := time.Now()
-	startedBool := now.After(startTime)
-	
-	debugTimes := "start: "
-	debugTimes += strconv.FormatInt(startTime.Unix(),10)
-	debugTimes += "; now: "
-	debugTimes += strconv.FormatInt(now.Unix(),10)
-	debugTimes += "; end: "
-	debugTimes += strconv.FormatInt(endTime.Unix(),10)
-	fmt.Println(debugTimes)
-
-	if now.After(endTime) {
-		return startedBool,true, nil
-	}
-	//Check for VoterPercentileCondition
-	if string(*endConditionMap["type"]) == "\"VoterPercentileCondition\"" {
-		neededPercentage, err := strconv.Atoi(string(*endConditionMap["percentage"]))
+// closeIfBallotReachesEndCondition evaluates the end condition against the
+// counters with and without delta, the counters of the ballot being cast.
+// It refuses the ballot if the condition is reached without it and closes
+// the election if the ballot reaches it. Writing the lifecycle invalidates
+// the votes of the same block that come after.
+//
+// Conditions on ballots are evaluated against the base plus every delta, so
+// no ballot goes past them; the range read of the deltas makes such votes
+// of the same block conflict. Once maxCounterDeltas deltas piled up the vote
+// folds them. Other conditions leave the counters unread.
+func closeIfBallotReachesEndCondition(stub shim.ChaincodeStubInterface, electionID string, electionData *ElectionData, lifecycle *Lifecycle, delta *Counters) error {
+	counters := newCounters()
+	if electionData.EndCondition.dependsOn()&ballotsInput != 0 {
+		var deltaKeys []string
+		var err error
+		counters, deltaKeys, err = getCounters(stub, electionID)
 		if err != nil {
-			return false,false, errors.New("Failed to parse percentage for VoterPercentileCondition")
+			return err
 		}
-		stateIterator, err := stub.GetStateByRange("v", "w")
-		if err != nil {
-			return false,false, errors.New("Failed to get StateIterator")
+		if len(deltaKeys) >= maxCounterDeltas {
+			err = compactCounters(stub, electionID, counters, deltaKeys)
+			if err != nil {
+				return err
+			}
 		}
-		defer stateIterator.Close()
+	}
+	now, err := nowUnix(stub)
+	if err != nil {
+		return err
+	}
 
-		numVotes := 0
-		for stateIterator.HasNext() {
-			numVotes++
-			stateIterator.Next()
-		}
+	state := &EndConditionState{
+		ElectionData:         electionData,
+		Counters:             counters,
+		Now:                  now,
+		ManualCloseRequested: lifecycle.ManualCloseRequested,
+	}
+	if electionData.EndCondition.reached(state) {
+		return errors.New("Election reached its end condition")
+	}
+	counters.add(delta)
+	if !electionData.EndCondition.reached(state) {
+		return nil
+	}
+	err = lifecycle.transition(stub, StateClosed, systemActor, "endCondition reached")
+	if err != nil {
+		return err
+	}
+	return putLifecycle(stub, electionID, lifecycle)
+}
 
-		numAllVoters, err := strconv.Atoi(string(*initMap["voterCount"]))
+// closeIfEndConditionReached folds the vote counters, evaluates the end
+// condition and persists the lifecycle. Once the end condition fired the
+// election stays closed, whatever later evaluations would compute.
+func closeIfEndConditionReached(stub shim.ChaincodeStubInterface, electionID string, electionData *ElectionData, lifecycle *Lifecycle) error {
+	counters, deltaKeys, err := getCounters(stub, electionID)
+	if err != nil {
+		return err
+	}
+	err = compactCounters(stub, electionID, counters, deltaKeys)
+	if err != nil {
+		return err
+	}
+	if electionData.Encryption != nil {
+		err = compactEncryptedTally(stub, electionID)
 		if err != nil {
-			return false,false, errors.New("Failed to parse voterCount")
+			return err
 		}
+	}
+	now, err := nowUnix(stub)
+	if err != nil {
+		return err
+	}
 
-		actualPercentage := int((float64(numVotes) / float64(numAllVoters))*100.0)
-		if actualPercentage >= neededPercentage {
-			return startedBool,true,nil
-		}
-	} else if string(*endConditionMap["type"]) == "\"CandidatePercentileCondition\"" {
-		neededPercentage, err := strconv.Atoi(string(*endConditionMap["percentage"]))
+	state := &EndConditionState{
+		ElectionData:         electionData,
+		Counters:             counters,
+		Now:                  now,
+		ManualCloseRequested: lifecycle.ManualCloseRequested,
+	}
+	if lifecycle.State == StateOpen && electionData.EndCondition.reached(state) {
+		err = lifecycle.transition(stub, StateClosed, systemActor, "endCondition reached")
 		if err != nil {
-			return false,false, errors.New("Failed to parse percentage for VoterPercentileCondition")
+			return err
 		}
+	}
+	return putLifecycle(stub, electionID, lifecycle)
+}
 
-		stateIterator, err := stub.GetStateByRange("v", "w")
-		if err != nil {
-			return false,false, errors.New("Failed to get StateIterator")
-		}
-		defer stateIterator.Close()
+// Record that an admin wants the election closed, which reaches
+// ManualCloseCondition, and evaluate the end condition.
+func (t *VoteChaincode) requestManualClose(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err := cid.AssertAttributeValue(stub,"admin","true")
+	if err != nil {
+		return shim.Error("User isn't admin")
+	}
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID")
+	}
+	electionID := args[0]
+	electionData, lifecycle, err := getElection(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if lifecycle.hasEnded() {
+		return shim.Error("Election has ended already")
+	}
 
-		var uniqueVotes []string
-		var numVotes []int
-		for stateIterator.HasNext() {
-			queryResponse, err := stateIterator.Next()
-			if err != nil {
-				return false,false, errors.New("StateIterator failed to retrieve next Element")
-			}
-			voteString := string(queryResponse.Value)
-			uniquePos := posOf(voteString,uniqueVotes)
-			if uniquePos == -1{
-				uniqueVotes = append(uniqueVotes, voteString)
-				numVotes = append(numVotes,1)
-			} else {
-				numVotes[uniquePos]+=1
-			}
-		}
+	lifecycle.ManualCloseRequested = true
+	lifecycle.changed = true
+	err = closeIfEndConditionReached(stub, electionID, electionData, lifecycle)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(lifecycle.State))
+}
 
-		numAllVoters, err := strconv.Atoi(string(*initMap["voterCount"]))
-		if err != nil {
-			return false,false, errors.New("Failed to parse voterCount")
-		}
+// ElectionStatus is the result of electionStatusQuery. Status is "running"
+// until voting is over for good and "ended" afterwards.
+type ElectionStatus struct {
+	ElectionID string        `json:"electionID"`
+	State      ElectionState `json:"state"`
+	Status     string        `json:"status"`
+	History    []Transition  `json:"history"`
+	Pause      *Pause        `json:"pause,omitempty"`
+	Pauses     []Pause       `json:"pauses,omitempty"`
+}
 
-		for _, num := range numVotes {
-			actualPercentage := int((float64(num) / float64(numAllVoters))*100.0)
-			if actualPercentage >= neededPercentage {
-				return startedBool,true,nil
-			}
-		}
+func (t *VoteChaincode) electionStatusQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID")
+	}
+	_, lifecycle, err := getElection(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
-	return startedBool,false,nil
+	returnJson, err := json.Marshal(ElectionStatus{
+		ElectionID: args[0],
+		State:      lifecycle.State,
+		Status:     lifecycle.legacyStatus(),
+		History:    lifecycle.History,
+		Pause:      lifecycle.activePause(),
+		Pauses:     lifecycle.Pauses,
+	})
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	return shim.Success(returnJson)
 }
 
+// Move an election to another lifecycle state on behalf of an admin.
+func (t *VoteChaincode) transitionElection(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err := cid.AssertAttributeValue(stub,"admin","true")
+	if err != nil {
+		return shim.Error("User isn't admin")
+	}
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID, the target state and optionally a reason")
+	}
+	electionID := args[0]
+	target := ElectionState(args[1])
+	reason := ""
+	if len(args) == 3 {
+		reason = args[2]
+	}
 
-func (t *VoteChaincode) electionStatusQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	_, ended, err := electionStartedEndedCheck(stub)
+	electionData, lifecycle, err := getElection(stub, electionID)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	if ended {
-		return shim.Success([]byte("ended"))
-	} else {
-		return shim.Success([]byte("running"))
+	if !lifecycle.canTransition(target) {
+		return shim.Error("Election can't move from " + string(lifecycle.State) + " to " + string(target))
+	}
+	if target == StatePaused || lifecycle.State == StatePaused && target == StateOpen {
+		return shim.Error("Use pauseElection and resumeElection to pause and resume an election")
+	}
+	if target == StateScheduled {
+		err = assertKeyCeremonyFinished(electionData)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if target == StateTallied {
+		err = assertRevealOver(stub, electionData, lifecycle)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = assertDecrypted(stub, electionID, electionData)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 	}
+	adminID, err := cid.GetID(stub)
+	if err != nil {
+		return shim.Error("Couldn't read ID from stub.")
+	}
+	err = lifecycle.transition(stub, target, adminID, reason)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putLifecycle(stub, electionID, lifecycle)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Election " + electionID + " moved to " + string(target) + " by " + adminID)
+	return shim.Success(nil)
 }
 
 func (t *VoteChaincode) ownVoteQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID")
+	}
+	electionData, lifecycle, err := getElection(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !lifecycle.hasStarted() {
+		return shim.Error("Election hasn't started yet")
+	}
 	creatorID, err := cid.GetID(stub)
 	if err != nil {
 		return shim.Error("Couldn't read ID from stub.")
 	}
-	key := "vote_" + creatorID
+	key, err := voteKey(stub, args[0], creatorID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	stateBytes, err := stub.GetState(key)
 	if err != nil {
 		return shim.Success(nil)
 	}
+	// Voters of private elections get their salt too, so they can check
+	// the hash on the ledger themselves.
+	if electionData.PrivateData != nil && stateBytes != nil {
+		private, err := readPrivateBallot(stub, electionData, key, stateBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		privateJson, err := json.Marshal(private)
+		if err != nil {
+			return shim.Error("Failed to generate Json")
+		}
+		return shim.Success(privateJson)
+	}
 
+	// Until the ballot of a commit-reveal election is revealed the voter
+	// gets their commitment.
+	if stateBytes == nil && electionData.CommitReveal != nil {
+		key, err = commitmentKey(stub, args[0], creatorID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		stateBytes, err = stub.GetState(key)
+		if err != nil {
+			return shim.Success(nil)
+		}
+	}
 	return shim.Success(stateBytes)
 }
 
 // Query Election Metadata on ledger.
 func (t *VoteChaincode) electionDataQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	stateBytes, err := stub.GetState("init")
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID")
+	}
+	key, err := initKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stateBytes, err := stub.GetState(key)
 	if err != nil {
 		return shim.Error("Failed to get state")
 	}
 	if stateBytes == nil {
 		return shim.Error("Election not initialized")
 	}
-
-	fmt.Printf("Responding with ElectionData: " + string(stateBytes))
 	return shim.Success(stateBytes)
 }
 
+// Write an archive record of an election, sealed by the ElectionReset event,
+// then delete its ElectionData and ballots so the election ID can be
+// initialized again. Expects the election ID and, unless the election is
+// closed, tallied or certified, the reason for resetting it anyway.
 func (t *VoteChaincode) destructionInvokation(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	err := cid.AssertAttributeValue(stub,"admin","true")
 	if err != nil {
 		return shim.Error("User isn't admin")
 	}
-	fmt.Println("RESTART")
-	return shim.Success(nil)
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID and optionally a reason")
+	}
+	electionID := args[0]
+
+	electionData, lifecycle, err := getElection(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	reason := "reset"
+	if len(args) == 2 {
+		reason = args[1]
+	}
+	switch lifecycle.State {
+	case StateClosed, StateTallied, StateCertified:
+	default:
+		if reason == "reset" || reason == "" {
+			return shim.Error("Election is " + string(lifecycle.State) + ", resetting it needs a reason")
+		}
+	}
+	adminID, err := cid.GetID(stub)
+	if err != nil {
+		return shim.Error("Couldn't read ID from stub.")
+	}
+	err = lifecycle.transition(stub, StateArchived, adminID, reason)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := nowUnix(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	tally, err := computeTally(stub, electionID, electionData)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var voteKeys []string
+	ballotHashes := []string{}
+	err = forEachBallot(stub, electionID, electionData, func(key string, value []byte) error {
+		voteKeys = append(voteKeys, key)
+		ballotHash, err := archivedBallotHash(stub, electionData, key, value)
+		if err != nil {
+			return err
+		}
+		ballotHashes = append(ballotHashes, ballotHash)
+		return nil
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	sort.Strings(ballotHashes)
+	spoiled, _, err := getSpoiledBallots(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	commitments, err := commitmentHashes(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var encrypted map[string]ciphertext
+	var decryptionShares []DecryptionShare
+	var keyCeremony *KeyCeremonyTranscript
+	if electionData.Encryption != nil {
+		encrypted, _, err = getEncryptedTally(stub, electionID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		decryptionShares, _, err = getDecryptionShares(stub, electionID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if electionData.Encryption.KeyCeremony {
+			keyCeremony, _, err = getKeyCeremony(stub, electionID)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+	}
+	writeInMappings, _, err := getWriteInMappings(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	record := ArchiveRecord{
+		ElectionID:   electionID,
+		ElectionData: *electionData,
+		Lifecycle:    *lifecycle,
+		ArchivedBy:   adminID,
+		ArchivedAt:   now,
+		TxID:         stub.GetTxID(),
+		BallotCount:  len(voteKeys),
+		Tally:        *tally,
+		BallotHashes: ballotHashes,
+	}
+	if len(spoiled) > 0 {
+		record.Spoiled = spoiled
+	}
+	if len(writeInMappings) > 0 {
+		record.WriteInMappings = writeInMappings
+	}
+	if len(commitments) > 0 {
+		record.Commitments = commitments
+	}
+	if electionData.Encryption != nil {
+		encryptedTally := encodeCiphertexts(encrypted)
+		record.EncryptedTally = &encryptedTally
+		record.DecryptionShares = decryptionShares
+		record.KeyCeremony = keyCeremony
+	}
+	recordJson, err := json.Marshal(record)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	recordKey, err := archiveKey(stub, electionID, record.TxID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(recordKey, recordJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	for _, key := range voteKeys {
+		err = stub.DelState(key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	err = deletePrivateBallots(stub, electionData, voteKeys)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := initKey(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.DelState(key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err = lifecycleKey(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.DelState(key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = deleteCounters(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = deleteWeights(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = deleteSpoiledBallots(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = deleteWriteInMappings(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = deleteCommitments(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = deleteEncryption(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = deleteKeyCeremony(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	eventJson, err := json.Marshal(ResetEvent{
+		ElectionID:  electionID,
+		Admin:       adminID,
+		ArchiveKey:  recordKey,
+		BallotCount: record.BallotCount,
+		Seal:        sealArchive(recordJson),
+	})
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	err = stub.SetEvent("ElectionReset", eventJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Election " + electionID + " archived and reset by " + adminID)
+	return shim.Success(recordJson)
 }
 
-// Write ElectionData on ledger with 'init' key.
-func (t *VoteChaincode) initializationInvokation(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var initMap map[string]*json.RawMessage
-	var endConditionMap map[string]*json.RawMessage
+// Query all archive records of an election ID. Records of elections whose
+// results the caller may not see yet are left out.
+func (t *VoteChaincode) archivesQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var resultSlice []ArchiveRecord = []ArchiveRecord{}
 
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID")
+	}
+	stateIterator, err := stub.GetStateByPartialCompositeKey(archiveObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error("Failed to get StateIterator")
+	}
+	defer stateIterator.Close()
+
+	for stateIterator.HasNext() {
+		queryResponse, err := stateIterator.Next()
+		if err != nil {
+			return shim.Error("StateIterator failed to retrieve next Element")
+		}
+		var record ArchiveRecord
+		err = json.Unmarshal(queryResponse.Value, &record)
+		if err != nil {
+			return shim.Error("Stored archive record couldn't be parsed")
+		}
+		if record.assertVisible(stub) != nil {
+			continue
+		}
+		resultSlice = append(resultSlice, record)
+	}
+
+	returnJson, err := json.Marshal(resultSlice)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	return shim.Success(returnJson)
+}
+
+// Write ElectionData of a new election on ledger under its 'init' key.
+func (t *VoteChaincode) initializationInvokation(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	err := cid.AssertAttributeValue(stub,"admin","true")
 	if err != nil {
 		return shim.Error("User isn't admin")
 	}
 
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting a single JSON string representing ElectionData")
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID and a JSON string representing ElectionData")
+	}
+	electionID := args[0]
+	err = validateElectionID(electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := initKey(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
-	var initJson = args[0]
-
-	stateBytes, err := stub.GetState("init")
+	stateBytes, err := stub.GetState(key)
 	if err != nil {
 		return shim.Error("Failed to get state")
 	}
@@ -270,50 +794,53 @@ func (t *VoteChaincode) initializationInvokation(stub shim.ChaincodeStubInterfac
 		return shim.Error("Init set already")
 	}
 
-	err = json.Unmarshal([]byte(initJson), &initMap)
+	electionData, err := parseElectionData([]byte(args[1]))
 	if err != nil {
-		return shim.Error("Json couldn't be parsed, maybe the initialization was done incorrectly.")
+		return shim.Error(err.Error())
 	}
-	err = json.Unmarshal([]byte(*initMap["endCondition"]), &endConditionMap)
+	if electionData.Encryption != nil && electionData.Encryption.KeyCeremony && !electionData.Encryption.keyCeremonyPending() {
+		return shim.Error("Keys of an election with a key ceremony are derived by finishKeyCeremony")
+	}
+	initJson, err := json.Marshal(electionData)
 	if err != nil {
-		return shim.Error("endCondition couldn't be parsed, maybe the initialization was done incorrectly.")
+		return shim.Error("Failed to generate Json")
 	}
 
-	_, err = strconv.ParseInt(string(*initMap["endDate"]), 10, 64)
+	err = stub.PutState(key, initJson)
 	if err != nil {
-		return shim.Error("The given Time couldn't be parsed: " + string(*initMap["endDate"]))
+		return shim.Error(err.Error())
 	}
 
-	if endConditionMap["type"] == nil {
-		return shim.Error("Endcondition Type couldn't be parsed, maybe the initialization was done incorrectly.")
+	adminID, err := cid.GetID(stub)
+	if err != nil {
+		return shim.Error("Couldn't read ID from stub.")
 	}
-	if string(*endConditionMap["type"]) != "\"TimeOnlyCondition\"" {
-		if endConditionMap["percentage"] == nil {
-			return shim.Error("Percentage couldn't be parsed, maybe the initialization was done incorrectly.")
-		}
+	lifecycle, err := newLifecycle(stub, adminID)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-
-	err = stub.PutState("init", []byte(initJson))
+	err = putLifecycle(stub, electionID, lifecycle)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	fmt.Println("Init written to Ledger:")
-	fmt.Println(initJson)
+	fmt.Println("Init of election " + electionID + " written to Ledger:")
+	fmt.Println(string(initJson))
 	return shim.Success(nil)
 }
 
 func (t *VoteChaincode) voteInvokation(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	started, ended, err := electionStartedEndedCheck(stub)
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID and a JSON string representing a Vote")
+	}
+	electionID := args[0]
+
+	electionData, lifecycle, err := getElection(stub, electionID)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	if !started || ended {
-		runningDebug := "Election started: "
-		runningDebug += strconv.FormatBool(started)
-		runningDebug += "; Election ended: "
-		runningDebug += strconv.FormatBool(ended)
-		fmt.Println(runningDebug)
+	if lifecycle.State != StateOpen {
+		fmt.Println("Election state: " + string(lifecycle.State))
 		return shim.Error("Election isn't running")
 	}
 
@@ -321,16 +848,21 @@ func (t *VoteChaincode) voteInvokation(stub shim.ChaincodeStubInterface, args []
 	if err == nil {
 		return shim.Error("User is admin therefore is not allowed to vote")
 	}
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting a single JSON string representing a Vote")
-	}
-	var voteJson = args[0]
-
 	creatorID, err := cid.GetID(stub)
 	if err != nil {
 		return shim.Error("Couldn't read ID from stub.")
 	}
-	key := "vote_" + creatorID
+	ballotJson, salt, err := submittedBallot(stub, electionData, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if electionData.CommitReveal != nil {
+		return commitVote(stub, electionID, electionData, lifecycle, creatorID, string(ballotJson))
+	}
+	key, err := voteKey(stub, electionID, creatorID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	stateBytes, err := stub.GetState(key)
 	if err != nil {
 		return shim.Error("Failed to get state")
@@ -339,17 +871,76 @@ func (t *VoteChaincode) voteInvokation(stub shim.ChaincodeStubInterface, args []
 		return shim.Error("User already voted once")
 	}
 
-	err = stub.PutState(key, []byte(voteJson))
+	ballot, err := parseBallot(ballotJson, electionData)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	if electionData.Encryption != nil {
+		err = verifyEncryptedBallot(electionID, creatorID, electionData, ballot)
+		if err != nil {
+			return shim.Error("Invalid ballot: " + err.Error())
+		}
+		err = putBallotCiphertexts(stub, electionID, electionData, ballot)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	ballot.Org, err = cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error("Couldn't read MSP ID from stub.")
+	}
+	ballot.Weight, err = voterWeight(stub, electionID, electionData, creatorID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	voteJson, err := json.Marshal(ballot)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+
+	err = putBallot(stub, electionData, key, voteJson, salt)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Only keys of this voter and transaction are written, unless the ballot
+	// reaches the end condition and closes the election.
+	counters, err := ballotCounters(electionData, ballot)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = closeIfBallotReachesEndCondition(stub, electionID, electionData, lifecycle, counters)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putCounterDelta(stub, electionID, counters)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if electionData.Encryption != nil {
+		ciphertexts, err := ballotCiphertexts(electionData, ballot)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = putEncryptedTallyDelta(stub, electionID, ciphertexts)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
 
 	return shim.Success(nil)
 }
 
 func (t *VoteChaincode) initStatusQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID")
+	}
+	key, err := initKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
-	stateBytes, err := stub.GetState("init")
+	stateBytes, err := stub.GetState(key)
 	if err != nil {
 		return shim.Success([]byte("true"))
 	}
@@ -359,14 +950,52 @@ func (t *VoteChaincode) initStatusQuery(stub shim.ChaincodeStubInterface, args [
 	return shim.Success([]byte("false"))
 }
 
-//Utility function
-func posOf(search string,array []string) int {
-	for p, v := range array {
-		if v == search {
-			return p
+// ElectionSummary is a single entry of the listElectionsQuery result.
+type ElectionSummary struct {
+	ElectionID   string        `json:"electionID"`
+	State        ElectionState `json:"state"`
+	Status       string        `json:"status"`
+	ElectionData ElectionData  `json:"electionData"`
+}
+
+// List every initialized election together with its current status.
+func (t *VoteChaincode) listElectionsQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var resultSlice []ElectionSummary = []ElectionSummary{}
+
+	stateIterator, err := stub.GetStateByPartialCompositeKey(initObjectType, []string{})
+	if err != nil {
+		return shim.Error("Failed to get StateIterator")
+	}
+	defer stateIterator.Close()
+
+	for stateIterator.HasNext() {
+		queryResponse, err := stateIterator.Next()
+		if err != nil {
+			return shim.Error("StateIterator failed to retrieve next Element")
 		}
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil || len(keyParts) != 1 {
+			return shim.Error("Failed to split key " + queryResponse.Key)
+		}
+		summary := ElectionSummary{ElectionID: keyParts[0]}
+		err = json.Unmarshal(queryResponse.Value, &summary.ElectionData)
+		if err != nil {
+			return shim.Error("Stored ElectionData of " + summary.ElectionID + " couldn't be parsed")
+		}
+		lifecycle, err := getLifecycle(stub, summary.ElectionID, &summary.ElectionData)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		summary.State = lifecycle.State
+		summary.Status = lifecycle.legacyStatus()
+		resultSlice = append(resultSlice, summary)
 	}
-	return -1
+
+	returnJson, err := json.Marshal(resultSlice)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	return shim.Success(returnJson)
 }
 
 func main() {
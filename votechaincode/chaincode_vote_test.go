@@ -0,0 +1,383 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/common/attrmgr"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const testMSPID = "org1MSP"
+
+// testIdentity is a client of the test network. ID is what cid.GetID
+// returns for it.
+type testIdentity struct {
+	ID      string
+	creator []byte
+}
+
+var testSerial int64
+
+// newIdentity returns an identity with a certificate for commonName that
+// carries attrs the way fabric-ca enrolls them.
+func newIdentity(t *testing.T, commonName string, attrs map[string]string) testIdentity {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrsJson, err := json.Marshal(attrmgr.Attributes{Attrs: attrs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSerial++
+	name := pkix.Name{CommonName: commonName, Organization: []string{"org1"}}
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(testSerial),
+		Subject:         name,
+		Issuer:          name,
+		NotBefore:       time.Unix(0, 0),
+		NotAfter:        time.Unix(testEndDate, 0).AddDate(10, 0, 0),
+		ExtraExtensions: []pkix.Extension{{Id: attrmgr.AttrOID, Value: attrsJson}},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   testMSPID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity := testIdentity{creator: creator}
+	identity.ID, err = cid.GetID(&testStub{creator: creator})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity
+}
+
+func newAdmin(t *testing.T) testIdentity {
+	return newIdentity(t, "admin", map[string]string{"admin": "true"})
+}
+
+func newVoter(t *testing.T, name string) testIdentity {
+	return newIdentity(t, name, nil)
+}
+
+// testStub is a MockStub with the parts of a proposal MockStub leaves out:
+// the creator, the transient map, the private data collections of the peer
+// and the events set by the chaincode.
+type testStub struct {
+	*shim.MockStub
+	args      [][]byte
+	creator   []byte
+	transient map[string][]byte
+
+	// collections holds the private data of the peer. With noCollection
+	// the peer isn't a member of any collection and reads nothing.
+	collections  map[string]map[string][]byte
+	noCollection bool
+
+	events  map[string][]byte
+	txCount int
+}
+
+func newTestStub() *testStub {
+	return &testStub{
+		MockStub:    shim.NewMockStub("vote", new(VoteChaincode)),
+		collections: make(map[string]map[string][]byte),
+		events:      make(map[string][]byte),
+	}
+}
+
+func (s *testStub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *testStub) GetStringArgs() []string {
+	args := make([]string, len(s.args))
+	for i, arg := range s.args {
+		args[i] = string(arg)
+	}
+	return args
+}
+
+func (s *testStub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+func (s *testStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func (s *testStub) GetTransient() (map[string][]byte, error) {
+	return s.transient, nil
+}
+
+func (s *testStub) GetPrivateData(collection, key string) ([]byte, error) {
+	if s.noCollection {
+		return nil, nil
+	}
+	return s.collections[collection][key], nil
+}
+
+func (s *testStub) PutPrivateData(collection, key string, value []byte) error {
+	if s.collections[collection] == nil {
+		s.collections[collection] = make(map[string][]byte)
+	}
+	s.collections[collection][key] = value
+	return nil
+}
+
+func (s *testStub) DelPrivateData(collection, key string) error {
+	delete(s.collections[collection], key)
+	return nil
+}
+
+func (s *testStub) SetEvent(name string, payload []byte) error {
+	s.events[name] = payload
+	return nil
+}
+
+// invokeTransient runs function with args and transient as a transaction of
+// identity.
+func (s *testStub) invokeTransient(identity testIdentity, transient map[string][]byte, function string, args ...string) pb.Response {
+	s.txCount++
+	txID := "tx" + strconv.Itoa(s.txCount)
+	s.args = [][]byte{[]byte(function)}
+	for _, arg := range args {
+		s.args = append(s.args, []byte(arg))
+	}
+	s.creator = identity.creator
+	s.transient = transient
+	s.MockTransactionStart(txID)
+	defer s.MockTransactionEnd(txID)
+	return new(VoteChaincode).Invoke(s)
+}
+
+// invoke runs function with args as a transaction of identity.
+func (s *testStub) invoke(identity testIdentity, function string, args ...string) pb.Response {
+	return s.invokeTransient(identity, nil, function, args...)
+}
+
+// mustInvoke fails the test unless the invocation succeeds and returns its
+// payload.
+func (s *testStub) mustInvoke(t *testing.T, identity testIdentity, function string, args ...string) []byte {
+	t.Helper()
+	response := s.invoke(identity, function, args...)
+	if response.Status != shim.OK {
+		t.Fatalf("%s%q failed: %s", function, args, response.Message)
+	}
+	return response.Payload
+}
+
+// expectError fails the test unless the invocation fails with a message
+// containing message.
+func (s *testStub) expectError(t *testing.T, message string, identity testIdentity, function string, args ...string) {
+	t.Helper()
+	response := s.invoke(identity, function, args...)
+	if response.Status == shim.OK {
+		t.Fatalf("%s%q succeeded, expected %q", function, args, message)
+	}
+	if !strings.Contains(response.Message, message) {
+		t.Fatalf("%s%q failed with %q, expected %q", function, args, response.Message, message)
+	}
+}
+
+// freezeClock replaces clock with a FrozenClock at the given time and
+// returns it together with a function restoring the previous clock.
+func freezeClock(at int64) (*FrozenClock, func()) {
+	previous := clock
+	frozen := &FrozenClock{Time: time.Unix(at, 0)}
+	clock = frozen
+	return frozen, func() { clock = previous }
+}
+
+// setClock moves frozen to the given time.
+func setClock(frozen *FrozenClock, at int64) {
+	frozen.Time = time.Unix(at, 0)
+}
+
+// testElectionJson returns ElectionData running from testStartDate to
+// testEndDate for voterCount voters with extra fields merged in, e.g.
+// `"candidates":[...]`.
+func testElectionJson(voterCount int, fields string) string {
+	return `{"title":"test","startDate":` + strconv.Itoa(testStartDate) + `,"endDate":` + strconv.Itoa(testEndDate) +
+		`,"voterCount":` + strconv.Itoa(voterCount) + `,` + fields + `}`
+}
+
+// scheduleElection initializes an election as admin and schedules it. The
+// clock must be before testStartDate.
+func scheduleElection(t *testing.T, stub *testStub, admin testIdentity, electionID, electionJson string) {
+	t.Helper()
+	stub.mustInvoke(t, admin, "initializationInvokation", electionID, electionJson)
+	stub.mustInvoke(t, admin, "transitionElection", electionID, string(StateScheduled))
+}
+
+// openElection schedules an election and moves frozen past testStartDate so
+// that it is open.
+func openElection(t *testing.T, stub *testStub, frozen *FrozenClock, admin testIdentity, electionID, electionJson string) {
+	t.Helper()
+	scheduleElection(t, stub, admin, electionID, electionJson)
+	setClock(frozen, testStartDate+1)
+}
+
+// electionState returns the current state of an election.
+func electionState(t *testing.T, stub *testStub, electionID string) ElectionState {
+	t.Helper()
+	var status ElectionStatus
+	err := json.Unmarshal(stub.mustInvoke(t, testIdentity{}, "electionStatusQuery", electionID), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status.State
+}
+
+// violationFields returns the fields of the violations listed in the
+// message of a rejected ElectionData.
+func violationFields(t *testing.T, message string) []string {
+	t.Helper()
+	var verr ValidationError
+	err := json.Unmarshal([]byte(message), &verr)
+	if err != nil {
+		t.Fatalf("%q isn't a ValidationError: %v", message, err)
+	}
+	fields := []string{}
+	for _, violation := range verr.Violations {
+		fields = append(fields, violation.Field)
+	}
+	return fields
+}
+
+func TestInitializationReportsEveryViolation(t *testing.T) {
+	_, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+
+	response := stub.invoke(admin, "initializationInvokation", "e",
+		`{"title":" ","startDate":1500003600,"endDate":1500000000,"voterCount":0,`+
+			`"candidates":[{"id":"a","name":"A"},{"id":"a","name":""}],"endCondition":{"type":"VoteCountCondition","count":0}}`)
+	if response.Status == shim.OK {
+		t.Fatal("invalid ElectionData accepted")
+	}
+	expected := []string{"title", "endDate", "voterCount", "candidates[1].id", "candidates[1].name", "endCondition.count"}
+	fields := violationFields(t, response.Message)
+	if strings.Join(fields, ",") != strings.Join(expected, ",") {
+		t.Errorf("violations of %v, expected %v", fields, expected)
+	}
+	if string(stub.mustInvoke(t, admin, "initStatusQuery", "e")) != "false" {
+		t.Error("invalid election was stored")
+	}
+}
+
+func TestInitializationRejectsMalformedPayloads(t *testing.T) {
+	_, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	valid := testElectionJson(1, `"candidates":[{"name":"A"}],"endCondition":{"type":"TimeOnlyCondition"}`)
+
+	payloads := map[string]string{
+		"unknown field":   strings.TrimSuffix(valid, "}") + `,"colour":"red"}`,
+		"trailing value":  valid + `{}`,
+		"stray bracket":   valid + `]`,
+		"wrong type":      strings.Replace(valid, `"voterCount":1`, `"voterCount":"1"`, 1),
+		"unknown endType": strings.Replace(valid, "TimeOnlyCondition", "NoSuchCondition", 1),
+	}
+	for name, payload := range payloads {
+		response := stub.invoke(admin, "initializationInvokation", "e", payload)
+		if response.Status == shim.OK {
+			t.Fatalf("%s: payload accepted", name)
+		}
+		if len(violationFields(t, response.Message)) == 0 {
+			t.Errorf("%s: no violation reported", name)
+		}
+	}
+
+	stub.mustInvoke(t, admin, "initializationInvokation", "e", valid)
+	electionData, err := getElectionData(stub, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if electionData.Candidates[0].ID != "a" {
+		t.Errorf("candidate ID %q, expected one derived from the name", electionData.Candidates[0].ID)
+	}
+	stub.expectError(t, "Init set already", admin, "initializationInvokation", "e", valid)
+	stub.expectError(t, "User isn't admin", newVoter(t, "voter"), "initializationInvokation", "f", valid)
+}
+
+func TestElectionsAreKeyedByID(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	voter := newVoter(t, "voter")
+
+	candidates := `"candidates":[{"id":"a","name":"A"},{"id":"b","name":"B"}],"endCondition":{"type":"TimeOnlyCondition"}`
+	scheduleElection(t, stub, admin, "board", testElectionJson(10, candidates))
+	openElection(t, stub, frozen, admin, "budget", strings.Replace(testElectionJson(10, candidates), `"test"`, `"budget"`, 1))
+	stub.expectError(t, "Election ID may only contain", admin, "initializationInvokation", "a b", testElectionJson(10, candidates))
+
+	stub.mustInvoke(t, voter, "voteInvokation", "board", `{"candidate":"a"}`)
+	stub.mustInvoke(t, voter, "voteInvokation", "budget", `{"candidate":"b"}`)
+	stub.expectError(t, "User already voted once", voter, "voteInvokation", "board", `{"candidate":"b"}`)
+	stub.expectError(t, "Init not set", voter, "voteInvokation", "other", `{"candidate":"b"}`)
+
+	for electionID, candidate := range map[string]string{"board": "a", "budget": "b"} {
+		var ballot Ballot
+		err := json.Unmarshal(stub.mustInvoke(t, voter, "ownVoteQuery", electionID), &ballot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ballot.Candidate != candidate || ballot.Org != testMSPID {
+			t.Errorf("%s: own vote %+v, expected candidate %s", electionID, ballot, candidate)
+		}
+	}
+
+	var electionData ElectionData
+	err := json.Unmarshal(stub.mustInvoke(t, voter, "electionDataQuery", "budget"), &electionData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if electionData.Title != "budget" {
+		t.Errorf("title %q, expected budget", electionData.Title)
+	}
+	stub.expectError(t, "Election not initialized", voter, "electionDataQuery", "other")
+
+	var summaries []ElectionSummary
+	err = json.Unmarshal(stub.mustInvoke(t, voter, "listElectionsQuery"), &summaries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 2 || summaries[0].ElectionID != "board" || summaries[1].ElectionID != "budget" {
+		t.Fatalf("listed %+v, expected board and budget", summaries)
+	}
+	for _, summary := range summaries {
+		if summary.State != StateOpen || summary.Status != "running" {
+			t.Errorf("%s is %s and %s, expected Open and running", summary.ElectionID, summary.State, summary.Status)
+		}
+	}
+}
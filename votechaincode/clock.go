@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Clock tells the chaincode what time it is. Every time based decision goes
+// through clock so that all endorsing peers agree and results can be
+// reproduced from the ledger later.
+type Clock interface {
+	Now(stub shim.ChaincodeStubInterface) (time.Time, error)
+}
+
+// clock is the Clock used by the chaincode. Tests replace it with a
+// FrozenClock to exercise start and end boundaries.
+var clock Clock = TxClock{}
+
+// TxClock reads the time from the timestamp the client put into the
+// transaction proposal, which is the same on every endorsing peer.
+type TxClock struct{}
+
+func (TxClock) Now(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil || txTimestamp == nil {
+		return time.Time{}, errors.New("Couldn't read transaction timestamp")
+	}
+	return time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC(), nil
+}
+
+// FrozenClock always returns Time until it is advanced.
+type FrozenClock struct {
+	Time time.Time
+}
+
+func (c *FrozenClock) Now(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	return c.Time, nil
+}
+
+// Advance moves the clock forward by d.
+func (c *FrozenClock) Advance(d time.Duration) {
+	c.Time = c.Time.Add(d)
+}
+
+// nowUnix returns the current time of clock in seconds since the epoch.
+func nowUnix(stub shim.ChaincodeStubInterface) (int64, error) {
+	now, err := clock.Now(stub)
+	if err != nil {
+		return 0, err
+	}
+	return now.Unix(), nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	testStartDate = 1500000000
+	testEndDate   = 1500003600
+)
+
+// newScheduledElection stores a Scheduled election running from
+// testStartDate to testEndDate.
+func newScheduledElection(t *testing.T, stub *shim.MockStub, electionID string) {
+	stub.MockTransactionStart("init")
+	defer stub.MockTransactionEnd("init")
+
+	electionData := new(ElectionData)
+	err := json.Unmarshal([]byte(`{"title":"clock","startDate":1500000000,"endDate":1500003600,"voterCount":1,"candidates":[{"id":"a","name":"A"}],"endCondition":{"type":"TimeOnlyCondition"}}`), electionData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = putElectionData(stub, electionID, electionData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lifecycle, err := newLifecycle(stub, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lifecycle.transition(stub, StateScheduled, "admin", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = putLifecycle(stub, electionID, lifecycle)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLifecycleFollowsClock(t *testing.T) {
+	defer func(c Clock) { clock = c }(clock)
+	frozen := &FrozenClock{Time: time.Unix(testStartDate-60, 0)}
+	clock = frozen
+
+	stub := shim.NewMockStub("vote", new(VoteChaincode))
+	newScheduledElection(t, stub, "e")
+
+	steps := []struct {
+		now   int64
+		state ElectionState
+	}{
+		{testStartDate - 1, StateScheduled},
+		// now.After(startDate) is false at startDate itself.
+		{testStartDate, StateScheduled},
+		{testStartDate + 1, StateOpen},
+		{testEndDate - 1, StateOpen},
+		{testEndDate, StateOpen},
+		{testEndDate + 1, StateClosed},
+	}
+	for _, step := range steps {
+		frozen.Advance(time.Unix(step.now, 0).Sub(frozen.Time))
+		_, lifecycle, err := getElection(stub, "e")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lifecycle.State != step.state {
+			t.Errorf("at %d: state %s, expected %s", step.now, lifecycle.State, step.state)
+		}
+	}
+}
+
+func TestLifecycleTransitionsAreStampedAtBoundaries(t *testing.T) {
+	defer func(c Clock) { clock = c }(clock)
+	frozen := &FrozenClock{Time: time.Unix(testStartDate-60, 0)}
+	clock = frozen
+
+	stub := shim.NewMockStub("vote", new(VoteChaincode))
+	newScheduledElection(t, stub, "e")
+
+	frozen.Advance(2 * time.Hour)
+	_, lifecycle, err := getElection(stub, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lifecycle.State != StateClosed {
+		t.Fatalf("state %s, expected %s", lifecycle.State, StateClosed)
+	}
+	history := lifecycle.History[len(lifecycle.History)-2:]
+	if history[0].To != StateOpen || history[0].At != testStartDate || history[0].By != systemActor {
+		t.Errorf("unexpected open transition %+v", history[0])
+	}
+	if history[1].To != StateClosed || history[1].At != testEndDate || history[1].By != systemActor {
+		t.Errorf("unexpected close transition %+v", history[1])
+	}
+}
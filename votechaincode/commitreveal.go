@@ -0,0 +1,369 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const commitmentObjectType = "commitment"
+
+// CommitReveal makes voters only commit to their ballot while voting is
+// open. voteInvokation then expects the commitment, the hex encoded SHA-256
+// of the length of a random salt of at least minSaltLength bytes in
+// decimal, a colon, the salt and the ballot JSON. The length keeps a salt
+// and ballot from opening the commitment of another split of the same
+// bytes. Once voting is over revealVote accepts the salt and the ballot
+// until RevealPeriod seconds after the election closed. Only revealed
+// ballots are counted.
+type CommitReveal struct {
+	RevealPeriod int64 `json:"revealPeriod"`
+}
+
+// Commitment is what voteInvokation stores for a voter of a commit–reveal
+// election. Org and Weight are recorded at commit time and carried over to
+// the revealed ballot.
+type Commitment struct {
+	VoterID     string `json:"voterID"`
+	Commitment  string `json:"commitment"`
+	Org         string `json:"org,omitempty"`
+	Weight      int    `json:"weight,omitempty"`
+	CommittedAt int64  `json:"committedAt"`
+	TxID        string `json:"txID"`
+}
+
+// CommitmentStatus is a single entry of the commitmentsQuery result.
+type CommitmentStatus struct {
+	Commitment
+	Revealed bool `json:"revealed"`
+}
+
+func (c *CommitReveal) validate(field string, verr *ValidationError) {
+	if c.RevealPeriod <= 0 {
+		verr.add(field+".revealPeriod", "must be greater than 0")
+	}
+}
+
+func commitmentKey(stub shim.ChaincodeStubInterface, electionID, voterID string) (string, error) {
+	return stub.CreateCompositeKey(commitmentObjectType, []string{electionID, voterID})
+}
+
+// validateCommitment checks that a commitment is a lowercase hex encoded
+// SHA-256.
+func validateCommitment(commitment string) error {
+	decoded, err := hex.DecodeString(commitment)
+	if err != nil || len(decoded) != sha256.Size || hex.EncodeToString(decoded) != commitment {
+		return errors.New("Commitment must be a lowercase hex encoded SHA-256")
+	}
+	return nil
+}
+
+// openCommitment returns the commitment a salt and ballot open.
+func openCommitment(salt, ballot string) string {
+	sum := sha256.Sum256([]byte(strconv.Itoa(len(salt)) + ":" + salt + ballot))
+	return hex.EncodeToString(sum[:])
+}
+
+// revealDeadline returns when the reveal window of a closed election ends.
+func revealDeadline(electionData *ElectionData, lifecycle *Lifecycle) int64 {
+	closedAt := electionData.EndDate
+	for _, transition := range lifecycle.History {
+		if transition.To == StateClosed {
+			closedAt = transition.At
+		}
+	}
+	return closedAt + electionData.CommitReveal.RevealPeriod
+}
+
+// assertRevealOver returns an error while ballots of a commit–reveal
+// election may still be revealed.
+func assertRevealOver(stub shim.ChaincodeStubInterface, electionData *ElectionData, lifecycle *Lifecycle) error {
+	if electionData.CommitReveal == nil || lifecycle.State != StateClosed {
+		return nil
+	}
+	now, err := nowUnix(stub)
+	if err != nil {
+		return err
+	}
+	if now <= revealDeadline(electionData, lifecycle) {
+		return errors.New("Ballots can be revealed until " + strconv.FormatInt(revealDeadline(electionData, lifecycle), 10))
+	}
+	return nil
+}
+
+// getCommitments returns the commitments of an election in key order and
+// the keys they are stored under.
+func getCommitments(stub shim.ChaincodeStubInterface, electionID string) ([]Commitment, []string, error) {
+	stateIterator, err := stub.GetStateByPartialCompositeKey(commitmentObjectType, []string{electionID})
+	if err != nil {
+		return nil, nil, errors.New("Failed to get StateIterator")
+	}
+	defer stateIterator.Close()
+
+	commitments := []Commitment{}
+	var keys []string
+	for stateIterator.HasNext() {
+		queryResponse, err := stateIterator.Next()
+		if err != nil {
+			return nil, nil, errors.New("StateIterator failed to retrieve next Element")
+		}
+		var commitment Commitment
+		err = json.Unmarshal(queryResponse.Value, &commitment)
+		if err != nil {
+			return nil, nil, errors.New("Stored commitment couldn't be parsed")
+		}
+		commitments = append(commitments, commitment)
+		keys = append(keys, queryResponse.Key)
+	}
+	return commitments, keys, nil
+}
+
+// unrevealedCommitments returns the commitments of an election whose
+// ballot wasn't revealed. voteKeys are the keys of the stored ballots.
+func unrevealedCommitments(stub shim.ChaincodeStubInterface, electionID string, voteKeys map[string]bool) ([]Commitment, error) {
+	commitments, _, err := getCommitments(stub, electionID)
+	if err != nil {
+		return nil, err
+	}
+	unrevealed := []Commitment{}
+	for _, commitment := range commitments {
+		key, err := voteKey(stub, electionID, commitment.VoterID)
+		if err != nil {
+			return nil, err
+		}
+		if !voteKeys[key] {
+			unrevealed = append(unrevealed, commitment)
+		}
+	}
+	return unrevealed, nil
+}
+
+// commitmentHashes returns the sorted commitments of an election for the
+// archive record.
+func commitmentHashes(stub shim.ChaincodeStubInterface, electionID string) ([]string, error) {
+	commitments, _, err := getCommitments(stub, electionID)
+	if err != nil {
+		return nil, err
+	}
+	hashes := []string{}
+	for _, commitment := range commitments {
+		hashes = append(hashes, commitment.Commitment)
+	}
+	sort.Strings(hashes)
+	return hashes, nil
+}
+
+// deleteCommitments removes the commitments of an election.
+func deleteCommitments(stub shim.ChaincodeStubInterface, electionID string) error {
+	_, keys, err := getCommitments(stub, electionID)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = stub.DelState(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commitVote stores the commitment of a voter of a commit–reveal election.
+// Only the ballot count is added to the counters, the choices are unknown
+// until the reveal. Like a ballot, the commitment closes the election if it
+// reaches the end condition.
+func commitVote(stub shim.ChaincodeStubInterface, electionID string, electionData *ElectionData, lifecycle *Lifecycle, voterID, commitment string) pb.Response {
+	err := validateCommitment(commitment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := commitmentKey(stub, electionID, voterID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stateBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error("Failed to get state")
+	}
+	if stateBytes != nil {
+		return shim.Error("User already voted once")
+	}
+
+	record := Commitment{
+		VoterID:    voterID,
+		Commitment: commitment,
+		TxID:       stub.GetTxID(),
+	}
+	record.Org, err = cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error("Couldn't read MSP ID from stub.")
+	}
+	record.Weight, err = voterWeight(stub, electionID, electionData, voterID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	record.CommittedAt, err = nowUnix(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	recordJson, err := json.Marshal(record)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	err = stub.PutState(key, recordJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	delta := newCounters()
+	delta.Ballots = 1
+	err = closeIfBallotReachesEndCondition(stub, electionID, electionData, lifecycle, delta)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putCounterDelta(stub, electionID, delta)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// Reveal the ballot committed to in a commit–reveal election. Expects the
+// election ID, the salt and the JSON ballot exactly as committed to. Only
+// accepted from the close of the election until the end of the reveal
+// period.
+func (t *VoteChaincode) revealVote(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID, the salt and a JSON string representing a Vote")
+	}
+	electionID := args[0]
+	electionData, lifecycle, err := getElection(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if electionData.CommitReveal == nil {
+		return shim.Error("Election doesn't use commit-reveal")
+	}
+	now, err := nowUnix(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if lifecycle.State != StateClosed || now > revealDeadline(electionData, lifecycle) {
+		return shim.Error("Ballots can only be revealed in the reveal period after the election closed")
+	}
+
+	creatorID, err := cid.GetID(stub)
+	if err != nil {
+		return shim.Error("Couldn't read ID from stub.")
+	}
+	key, err := commitmentKey(stub, electionID, creatorID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stateBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error("Failed to get state")
+	}
+	if stateBytes == nil {
+		return shim.Error("User didn't commit to a ballot")
+	}
+	var commitment Commitment
+	err = json.Unmarshal(stateBytes, &commitment)
+	if err != nil {
+		return shim.Error("Stored commitment couldn't be parsed")
+	}
+	ballotKey, err := voteKey(stub, electionID, creatorID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stateBytes, err = stub.GetState(ballotKey)
+	if err != nil {
+		return shim.Error("Failed to get state")
+	}
+	if stateBytes != nil {
+		return shim.Error("Ballot already revealed")
+	}
+
+	if len(args[1]) < minSaltLength {
+		return shim.Error("Salt must be at least " + strconv.Itoa(minSaltLength) + " bytes long")
+	}
+	if openCommitment(args[1], args[2]) != commitment.Commitment {
+		return shim.Error("Salt and ballot don't match the commitment")
+	}
+	ballot, err := parseBallot([]byte(args[2]), electionData)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ballot.Org = commitment.Org
+	ballot.Weight = commitment.Weight
+	voteJson, err := json.Marshal(ballot)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	err = stub.PutState(ballotKey, voteJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// The ballot itself was counted when it was committed.
+	counters, err := ballotCounters(electionData, ballot)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	counters.Ballots = 0
+	err = putCounterDelta(stub, electionID, counters)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Ballot of " + creatorID + " in election " + electionID + " revealed")
+	return shim.Success(nil)
+}
+
+// Query the commitments of a commit–reveal election and whether their
+// ballots were revealed.
+func (t *VoteChaincode) commitmentsQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID")
+	}
+	electionData, lifecycle, err := getElection(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if electionData.CommitReveal == nil {
+		return shim.Error("Election doesn't use commit-reveal")
+	}
+	if !lifecycle.hasStarted() {
+		return shim.Error("Election hasn't started yet")
+	}
+
+	commitments, _, err := getCommitments(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	result := []CommitmentStatus{}
+	for _, commitment := range commitments {
+		key, err := voteKey(stub, args[0], commitment.VoterID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		stateBytes, err := stub.GetState(key)
+		if err != nil {
+			return shim.Error("Failed to get state")
+		}
+		result = append(result, CommitmentStatus{Commitment: commitment, Revealed: stateBytes != nil})
+	}
+	resultJson, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	return shim.Success(resultJson)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+const testSalt = "0123456789abcdef"
+
+// commit returns the commitment to ballot with salt as a client computes
+// it.
+func commit(salt, ballot string) string {
+	sum := sha256.Sum256([]byte(strconv.Itoa(len(salt)) + ":" + salt + ballot))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCommitAndReveal(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	alice := newVoter(t, "alice")
+	bob := newVoter(t, "bob")
+
+	// The commitment that reaches the vote count closes the election.
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, `"commitReveal":{"revealPeriod":600},`+
+		`"candidates":[{"id":"a","name":"A"},{"id":"b","name":"B"}],"endCondition":{"type":"VoteCountCondition","count":2}`))
+	stub.expectError(t, "Commitment must be a lowercase hex encoded SHA-256", alice, "voteInvokation", "e", `{"candidate":"a"}`)
+	stub.mustInvoke(t, alice, "voteInvokation", "e", commit(testSalt, `{"candidate":"a"}`))
+	stub.expectError(t, "User already voted once", alice, "voteInvokation", "e", commit(testSalt, `{"candidate":"b"}`))
+	stub.expectError(t, "Ballots can only be revealed in the reveal period", alice, "revealVote", "e", testSalt, `{"candidate":"a"}`)
+	setClock(frozen, testStartDate+100)
+	stub.mustInvoke(t, bob, "voteInvokation", "e", commit(testSalt, `{"candidate":"b"}`))
+	if state := electionState(t, stub, "e"); state != StateClosed {
+		t.Fatalf("state %s after the second commitment, expected Closed", state)
+	}
+	stub.expectError(t, "Election isn't running", newVoter(t, "late"), "voteInvokation", "e", commit(testSalt, `{"candidate":"a"}`))
+	stub.expectError(t, "Results are hidden until the reveal period is over", alice, "tallyQuery", "e")
+
+	stub.expectError(t, "Salt and ballot don't match the commitment", alice, "revealVote", "e", testSalt, `{"candidate":"b"}`)
+	stub.expectError(t, "Salt and ballot don't match the commitment", alice, "revealVote", "e", testSalt+"{", `"candidate":"a"}`)
+	stub.mustInvoke(t, alice, "revealVote", "e", testSalt, `{"candidate":"a"}`)
+	stub.expectError(t, "Ballot already revealed", alice, "revealVote", "e", testSalt, `{"candidate":"a"}`)
+	stub.expectError(t, "User didn't commit to a ballot", newVoter(t, "other"), "revealVote", "e", testSalt, `{"candidate":"a"}`)
+
+	// The reveal period runs from the close, not from endDate.
+	setClock(frozen, testStartDate+701)
+	stub.expectError(t, "Ballots can only be revealed in the reveal period", bob, "revealVote", "e", testSalt, `{"candidate":"b"}`)
+
+	tally := queryTally(t, stub, bob, "e")
+	if tally.TotalBallots != 1 || tally.UnrevealedBallots != 1 || tally.Turnout != 20 {
+		t.Errorf("unexpected totals %+v", tally)
+	}
+	if !reflect.DeepEqual(tally.Results, []CandidateResult{{"a", "A", 1}, {"b", "B", 0}}) {
+		t.Errorf("results %+v, expected only the revealed ballot", tally.Results)
+	}
+
+	var commitments []CommitmentStatus
+	err := json.Unmarshal(stub.mustInvoke(t, bob, "commitmentsQuery", "e"), &commitments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revealed := map[string]bool{}
+	for _, commitment := range commitments {
+		revealed[commitment.VoterID] = commitment.Revealed
+	}
+	if len(commitments) != 2 || !revealed[alice.ID] || revealed[bob.ID] {
+		t.Errorf("unexpected commitments %+v", commitments)
+	}
+}
+
+func TestRevealRejectsShortSalts(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	voter := newVoter(t, "voter")
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, `"commitReveal":{"revealPeriod":600},`+lifecycleTestElection))
+	stub.mustInvoke(t, voter, "voteInvokation", "e", commit("salt", `{"candidate":"a"}`))
+	setClock(frozen, testEndDate+1)
+	stub.expectError(t, "Salt must be at least 16 bytes long", voter, "revealVote", "e", "salt", `{"candidate":"a"}`)
+}
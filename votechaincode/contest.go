@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ContestRules are the candidates of a contest and how voters choose among
+// them.
+type ContestRules struct {
+	Candidates []Candidate `json:"candidates,omitempty"`
+
+	// VotingMethod decides what ballots look like and how they are
+	// counted. Defaults to plurality.
+	VotingMethod string `json:"votingMethod,omitempty"`
+	// MinSelections and MaxSelections limit how many candidates an approval
+	// or score ballot may mark. A MaxSelections of 0 means no limit.
+	MinSelections int `json:"minSelections,omitempty"`
+	MaxSelections int `json:"maxSelections,omitempty"`
+	// Seats is the number of candidates the contest elects, 1 if unset.
+	Seats int `json:"seats,omitempty"`
+	// Referendum are the pass rules of a referendum contest.
+	Referendum *ReferendumRules `json:"referendum,omitempty"`
+	// WriteIns is the number of write-in slots of a plurality or approval
+	// ballot. Write-ins are counted once an official mapped them to
+	// candidates with mapWriteIns.
+	WriteIns int `json:"writeIns,omitempty"`
+}
+
+// Contest is one race or question of an election with several of them.
+// Ballots answer every contest separately and each contest is tallied on
+// its own.
+type Contest struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	ContestRules
+}
+
+// contests returns the contests of an election. An election without
+// Contests is a single contest with an empty ID.
+func (e *ElectionData) contests() []*Contest {
+	if len(e.Contests) == 0 {
+		return []*Contest{{ContestRules: e.ContestRules}}
+	}
+	contests := make([]*Contest, len(e.Contests))
+	for i := range e.Contests {
+		contests[i] = &e.Contests[i]
+	}
+	return contests
+}
+
+// contest returns the contest with the given ID. Elections without
+// Contests only have the contest "".
+func (e *ElectionData) contest(contestID string) (*Contest, error) {
+	if len(e.Contests) == 0 {
+		if contestID != "" {
+			return nil, errors.New("Election has no contests")
+		}
+		return e.contests()[0], nil
+	}
+	if contestID == "" {
+		return nil, errors.New("Election has several contests. Expecting the contest ID")
+	}
+	index := e.contestIndex(contestID)
+	if index == -1 {
+		return nil, errors.New("Unknown contest \"" + contestID + "\"")
+	}
+	return &e.Contests[index], nil
+}
+
+// contestRules returns the rules of the contest with the given ID for
+// modification.
+func (e *ElectionData) contestRules(contestID string) (*ContestRules, error) {
+	if len(e.Contests) == 0 && contestID == "" {
+		return &e.ContestRules, nil
+	}
+	contest, err := e.contest(contestID)
+	if err != nil {
+		return nil, err
+	}
+	return &contest.ContestRules, nil
+}
+
+// contestIndex returns the position of the contest with the given ID or -1
+// if there is none.
+func (e *ElectionData) contestIndex(contestID string) int {
+	for i, contest := range e.Contests {
+		if contest.ID == contestID {
+			return i
+		}
+	}
+	return -1
+}
+
+// candidateKey is how a candidate of the contest is named in Counters.
+// Candidates of an election without contests are counted by their ID.
+func (c *Contest) candidateKey(candidateID string) string {
+	if c.ID == "" {
+		return candidateID
+	}
+	return c.ID + "/" + candidateID
+}
+
+// votingMethod returns the VotingMethod of a contest. Contests without a
+// votingMethod use plurality voting.
+func (r *ContestRules) votingMethod() (VotingMethod, error) {
+	name := r.VotingMethod
+	if name == "" {
+		name = PluralityMethod
+	}
+	method, ok := votingMethods[name]
+	if !ok {
+		return nil, errors.New("unknown votingMethod \"" + name + "\"")
+	}
+	return method, nil
+}
+
+// validate adds a violation for every invalid rule to verr. field prefixes
+// the names of the violated fields.
+func (r *ContestRules) validate(field string, verr *ValidationError) {
+	if len(r.Candidates) == 0 && r.VotingMethod != ReferendumMethod {
+		verr.add(field+"candidates", "must contain at least one candidate")
+	}
+	if r.Referendum != nil && r.VotingMethod != ReferendumMethod {
+		verr.add(field+"referendum", "only used by referendums")
+	}
+	r.validateCandidates(field, verr)
+	if r.WriteIns < 0 {
+		verr.add(field+"writeIns", "must not be negative")
+	}
+
+	if r.Seats < 0 {
+		verr.add(field+"seats", "must be greater than 0")
+	} else if len(r.Candidates) > 0 && r.Seats > len(r.Candidates) {
+		verr.add(field+"seats", "must not exceed the number of candidates")
+	}
+
+	method, err := r.votingMethod()
+	if err != nil {
+		verr.add(field+"votingMethod", err.Error())
+	} else {
+		method.validateRules(r, field, verr)
+	}
+}
+
+// validateCandidates checks that every candidate of the registry has a
+// valid, unique ID and a unique name.
+func (r *ContestRules) validateCandidates(field string, verr *ValidationError) {
+	seenNames := make(map[string]int)
+	seenIDs := make(map[string]int)
+	for i, candidate := range r.Candidates {
+		candidateField := field + "candidates[" + strconv.Itoa(i) + "]"
+		err := validateID("Candidate ID", candidate.ID)
+		if err != nil {
+			verr.add(candidateField+".id", err.Error())
+		} else if first, ok := seenIDs[candidate.ID]; ok {
+			verr.add(candidateField+".id", "duplicates candidates["+strconv.Itoa(first)+"]")
+		} else {
+			seenIDs[candidate.ID] = i
+		}
+
+		name := normalizeName(candidate.Name)
+		if name == "" {
+			verr.add(candidateField+".name", "must not be empty")
+			continue
+		}
+		if first, ok := seenNames[name]; ok {
+			verr.add(candidateField+".name", "duplicates candidates["+strconv.Itoa(first)+"]")
+			continue
+		}
+		seenNames[name] = i
+	}
+}
+
+// validateContests checks the contests of an election. The rules of the
+// election itself must be left empty then.
+func (e *ElectionData) validateContests(verr *ValidationError) {
+	if len(e.Candidates) != 0 {
+		verr.add("candidates", "must be set per contest")
+	}
+	if e.VotingMethod != "" {
+		verr.add("votingMethod", "must be set per contest")
+	}
+	if e.MinSelections != 0 {
+		verr.add("minSelections", "must be set per contest")
+	}
+	if e.MaxSelections != 0 {
+		verr.add("maxSelections", "must be set per contest")
+	}
+	if e.Seats != 0 {
+		verr.add("seats", "must be set per contest")
+	}
+	if e.WriteIns != 0 {
+		verr.add("writeIns", "must be set per contest")
+	}
+
+	seenIDs := make(map[string]int)
+	for i, contest := range e.Contests {
+		field := "contests[" + strconv.Itoa(i) + "]"
+		err := validateID("Contest ID", contest.ID)
+		if err != nil {
+			verr.add(field+".id", err.Error())
+		} else if first, ok := seenIDs[contest.ID]; ok {
+			verr.add(field+".id", "duplicates contests["+strconv.Itoa(first)+"]")
+		} else {
+			seenIDs[contest.ID] = i
+		}
+		if normalizeName(contest.Title) == "" {
+			verr.add(field+".title", "must not be empty")
+		}
+		contest.ContestRules.validate(field+".", verr)
+	}
+}
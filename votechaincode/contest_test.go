@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const contestTestElection = `"contests":[` +
+	`{"id":"chair","title":"Chair","candidates":[{"id":"a","name":"A"},{"id":"b","name":"B"}]},` +
+	`{"id":"treasurer","title":"Treasurer","votingMethod":"approval","maxSelections":2,"candidates":[{"id":"x","name":"X"},{"id":"y","name":"Y"},{"id":"z","name":"Z"}]},` +
+	`{"id":"q1","title":"Question 1","votingMethod":"referendum","referendum":{"threshold":"simple"}}` +
+	`],"endCondition":{"type":"TimeOnlyCondition"}`
+
+func TestContestsAreValidatedAtomically(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	voter := newVoter(t, "voter")
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, contestTestElection))
+	ballots := map[string]string{
+		`{"candidate":"a"}`: "candidate not allowed, expecting contests",
+		`{"contests":{"chair":{"candidate":"a"},"treasurer":{"approvals":["x"]}}}`:                                    `no answer for contest "q1"`,
+		`{"contests":{"chair":{"candidate":"a"},"treasurer":{"approvals":["x"]},"q1":{"choice":"yes"},"q2":{}}}`:      `unknown contest "q2"`,
+		`{"contests":{"chair":{"candidate":"x"},"treasurer":{"approvals":["x"]},"q1":{"choice":"yes"}}}`:              `contest "chair": unknown candidate "x"`,
+		`{"contests":{"chair":{"candidate":"a"},"treasurer":{"approvals":["x","y","z"]},"q1":{"choice":"yes"}}}`:      `contest "treasurer": at most 2 candidates may be selected`,
+		`{"contests":{"chair":{"candidate":"a"},"treasurer":{"approvals":["x"]},"q1":{"choice":"maybe"}}}`:            `contest "q1": choice must be yes, no or abstain`,
+		`{"contests":{"chair":{"candidate":"a","blank":true},"treasurer":{"approvals":["x"]},"q1":{"choice":"yes"}}}`: `contest "chair": candidate not allowed, expecting blank`,
+	}
+	for ballot, message := range ballots {
+		stub.expectError(t, message, voter, "voteInvokation", "e", ballot)
+	}
+	// A ballot with a single invalid answer isn't stored at all.
+	if stub.mustInvoke(t, voter, "ownVoteQuery", "e") != nil {
+		t.Fatal("invalid ballot was stored")
+	}
+}
+
+func TestContestsAreTalliedSeparately(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, contestTestElection))
+	castBallots(t, stub, "e",
+		`{"contests":{"chair":{"candidate":"a"},"treasurer":{"approvals":["x","y"]},"q1":{"choice":"yes"}}}`,
+		`{"contests":{"chair":{"candidate":"b"},"treasurer":{"approvals":["y"]},"q1":{"choice":"no"}}}`,
+		`{"contests":{"chair":{"candidate":"a"},"treasurer":{"blank":true},"q1":{"choice":"yes"}}}`,
+	)
+	setClock(frozen, testEndDate+1)
+
+	tally := queryTally(t, stub, admin, "e")
+	if tally.ContestTally != nil || len(tally.Contests) != 3 {
+		t.Fatalf("unexpected tally %+v, expected one result per contest", tally)
+	}
+	if tally.TotalBallots != 3 || tally.ValidBallots != 3 || tally.BlankBallots != 0 {
+		t.Errorf("unexpected totals %+v", tally)
+	}
+	chair, treasurer, q1 := tally.Contests[0], tally.Contests[1], tally.Contests[2]
+	if chair.ContestID != "chair" || chair.Title != "Chair" || !reflect.DeepEqual(chair.Results, []CandidateResult{{"a", "A", 2}, {"b", "B", 1}}) || !reflect.DeepEqual(chair.Winners, []string{"a"}) {
+		t.Errorf("unexpected chair result %+v", chair)
+	}
+	if treasurer.ContestID != "treasurer" || treasurer.Valid != 2 || treasurer.Blank != 1 || !reflect.DeepEqual(treasurer.Winners, []string{"y"}) {
+		t.Errorf("unexpected treasurer result %+v", treasurer)
+	}
+	if q1.ContestID != "q1" || q1.Referendum == nil || q1.Referendum.Yes != 2 || q1.Referendum.No != 1 || q1.Referendum.Outcome != OutcomePassed {
+		t.Errorf("unexpected q1 result %+v", q1)
+	}
+}
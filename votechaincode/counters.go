@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Vote counters are kept as a compacted base under counterObjectType plus
+// one delta per vote under counterDeltaObjectType. voteInvokation
+// blind-writes its own delta and only reads the others if the end condition
+// counts ballots, so votes of elections that close on time alone never
+// write a key another one reads and validate in parallel.
+// evaluateEndCondition folds the deltas into the base, and so does a vote
+// that reads maxCounterDeltas of them.
+const (
+	counterObjectType      = "counter"
+	counterDeltaObjectType = "counterdelta"
+	maxCounterDeltas       = 100
+)
+
+// Kinds of ballots end conditions can count.
+const (
+	// CastBallots are all ballots cast.
+	CastBallots = "cast"
+	// CountedBallots are the cast ballots that weren't spoiled.
+	CountedBallots = "counted"
+	// ValidBallots are the counted ballots that aren't blank.
+	ValidBallots = "valid"
+)
+
+// Counters are the running totals end conditions are evaluated against.
+// Ballots counts every cast ballot, Spoiled those spoiled by an admin since
+// and Blank the ones left that answer every contest blank. Spoiled ballots
+// don't count for any candidate. Candidates of an election with contests are
+// counted as "contestID/candidateID".
+type Counters struct {
+	Ballots    int            `json:"ballots"`
+	Blank      int            `json:"blank,omitempty"`
+	Spoiled    int            `json:"spoiled,omitempty"`
+	Candidates map[string]int `json:"candidates"`
+}
+
+func newCounters() *Counters {
+	return &Counters{Candidates: make(map[string]int)}
+}
+
+func (c *Counters) add(other *Counters) {
+	c.Ballots += other.Ballots
+	c.Blank += other.Blank
+	c.Spoiled += other.Spoiled
+	for candidateID, votes := range other.Candidates {
+		c.Candidates[candidateID] += votes
+	}
+}
+
+// ballotCounters is the delta a valid ballot adds to the counters. The
+// counters are on the channel ledger, so for private elections they only
+// count the ballot.
+func ballotCounters(electionData *ElectionData, ballot *Ballot) (*Counters, error) {
+	counters := newCounters()
+	counters.Ballots = 1
+	if electionData.PrivateData != nil {
+		return counters, nil
+	}
+	for _, contest := range electionData.contests() {
+		method, err := contest.votingMethod()
+		if err != nil {
+			return nil, err
+		}
+		answer := ballot.answer(contest)
+		if answer.Blank {
+			continue
+		}
+		for candidateID, votes := range method.counters(answer).Candidates {
+			counters.Candidates[contest.candidateKey(candidateID)] += votes
+		}
+	}
+	if ballot.isBlank(electionData) {
+		counters.Blank = 1
+	}
+	return counters, nil
+}
+
+// ballots returns the number of ballots of the given kind, one of the
+// *Ballots constants. An empty kind counts every cast ballot.
+func (c *Counters) ballots(kind string) int {
+	switch kind {
+	case CountedBallots:
+		return c.Ballots - c.Spoiled
+	case ValidBallots:
+		return c.Ballots - c.Spoiled - c.Blank
+	}
+	return c.Ballots
+}
+
+// putCounterDelta records the delta of the current transaction.
+func putCounterDelta(stub shim.ChaincodeStubInterface, electionID string, delta *Counters) error {
+	key, err := stub.CreateCompositeKey(counterDeltaObjectType, []string{electionID, stub.GetTxID()})
+	if err != nil {
+		return err
+	}
+	deltaJson, err := json.Marshal(delta)
+	if err != nil {
+		return errors.New("Failed to generate Json")
+	}
+	return stub.PutState(key, deltaJson)
+}
+
+// getBaseCounters returns the compacted counters of an election without the
+// deltas.
+func getBaseCounters(stub shim.ChaincodeStubInterface, electionID string) (*Counters, error) {
+	counters := newCounters()
+	key, err := stub.CreateCompositeKey(counterObjectType, []string{electionID})
+	if err != nil {
+		return nil, err
+	}
+	stateBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get state")
+	}
+	if stateBytes != nil {
+		err = json.Unmarshal(stateBytes, counters)
+		if err != nil {
+			return nil, errors.New("Stored counters couldn't be parsed")
+		}
+	}
+	return counters, nil
+}
+
+// getCounters returns the current counters of an election, i.e. the base
+// plus every delta not compacted yet, and the keys of those deltas.
+func getCounters(stub shim.ChaincodeStubInterface, electionID string) (*Counters, []string, error) {
+	counters, err := getBaseCounters(stub, electionID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stateIterator, err := stub.GetStateByPartialCompositeKey(counterDeltaObjectType, []string{electionID})
+	if err != nil {
+		return nil, nil, errors.New("Failed to get StateIterator")
+	}
+	defer stateIterator.Close()
+
+	var deltaKeys []string
+	for stateIterator.HasNext() {
+		queryResponse, err := stateIterator.Next()
+		if err != nil {
+			return nil, nil, errors.New("StateIterator failed to retrieve next Element")
+		}
+		delta := newCounters()
+		err = json.Unmarshal(queryResponse.Value, delta)
+		if err != nil {
+			return nil, nil, errors.New("Stored counter delta couldn't be parsed")
+		}
+		counters.add(delta)
+		deltaKeys = append(deltaKeys, queryResponse.Key)
+	}
+	return counters, deltaKeys, nil
+}
+
+// compactCounters stores counters as the new base and deletes the deltas
+// folded into it.
+func compactCounters(stub shim.ChaincodeStubInterface, electionID string, counters *Counters, deltaKeys []string) error {
+	if len(deltaKeys) == 0 {
+		return nil
+	}
+	key, err := stub.CreateCompositeKey(counterObjectType, []string{electionID})
+	if err != nil {
+		return err
+	}
+	countersJson, err := json.Marshal(counters)
+	if err != nil {
+		return errors.New("Failed to generate Json")
+	}
+	err = stub.PutState(key, countersJson)
+	if err != nil {
+		return err
+	}
+	for _, deltaKey := range deltaKeys {
+		err = stub.DelState(deltaKey)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteCounters removes the base and all deltas of an election.
+func deleteCounters(stub shim.ChaincodeStubInterface, electionID string) error {
+	key, err := stub.CreateCompositeKey(counterObjectType, []string{electionID})
+	if err != nil {
+		return err
+	}
+	err = stub.DelState(key)
+	if err != nil {
+		return err
+	}
+	_, deltaKeys, err := getCounters(stub, electionID)
+	if err != nil {
+		return err
+	}
+	for _, deltaKey := range deltaKeys {
+		err = stub.DelState(deltaKey)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestVoteReachingEndConditionClosesElection(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, `"candidates":[{"id":"a","name":"A"}],"endCondition":{"type":"VoteCountCondition","count":3}`))
+	castBallots(t, stub, "e", `{"candidate":"a"}`, `{"candidate":"a"}`)
+	if state := electionState(t, stub, "e"); state != StateOpen {
+		t.Fatalf("state %s after two of three ballots, expected Open", state)
+	}
+	// No evaluateEndCondition in between: the third vote sees the deltas of
+	// the first two and closes the election itself.
+	castBallots(t, stub, "e", `{"candidate":"a"}`)
+	if state := electionState(t, stub, "e"); state != StateClosed {
+		t.Fatalf("state %s after the third ballot, expected Closed", state)
+	}
+	stub.expectError(t, "Election isn't running", newVoter(t, "late"), "voteInvokation", "e", `{"candidate":"a"}`)
+
+	var status ElectionStatus
+	err := json.Unmarshal(stub.mustInvoke(t, admin, "electionStatusQuery", "e"), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := status.History[len(status.History)-1]
+	if closed.To != StateClosed || closed.By != systemActor || closed.Reason != "endCondition reached" {
+		t.Errorf("unexpected close transition %+v", closed)
+	}
+	if turnout := queryTally(t, stub, admin, "e").TotalBallots; turnout != 3 {
+		t.Errorf("%d ballots counted, expected 3", turnout)
+	}
+}
+
+func TestEvaluateEndConditionFoldsDeltas(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	voter := newVoter(t, "voter")
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, lifecycleTestElection))
+	stub.mustInvoke(t, voter, "voteInvokation", "e", `{"candidate":"a"}`)
+	castBallots(t, stub, "e", `{"candidate":"a"}`)
+	stub.expectError(t, "User isn't admin", voter, "evaluateEndCondition", "e")
+
+	counters, deltaKeys, err := getCounters(stub, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counters.Ballots != 2 || len(deltaKeys) != 2 {
+		t.Fatalf("%d ballots in %d deltas, expected 2 in 2", counters.Ballots, len(deltaKeys))
+	}
+	if state := string(stub.mustInvoke(t, admin, "evaluateEndCondition", "e")); state != string(StateOpen) {
+		t.Errorf("state %s after evaluation, expected Open", state)
+	}
+	base, err := getBaseCounters(stub, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counters, deltaKeys, err = getCounters(stub, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base.Ballots != 2 || base.Candidates["a"] != 2 || len(deltaKeys) != 0 || counters.Ballots != 2 {
+		t.Errorf("base %+v with %d deltas left, expected every delta folded", base, len(deltaKeys))
+	}
+}
+
+func TestVotesCompactPiledUpDeltas(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(2*maxCounterDeltas, `"candidates":[{"id":"a","name":"A"}],"endCondition":{"type":"AllVotersCondition"}`))
+	for i := 0; i <= maxCounterDeltas; i++ {
+		castBallots(t, stub, "e", `{"candidate":"a"}`)
+	}
+	base, err := getBaseCounters(stub, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counters, deltaKeys, err := getCounters(stub, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base.Ballots != maxCounterDeltas || len(deltaKeys) != 1 || counters.Ballots != maxCounterDeltas+1 {
+		t.Errorf("base of %d ballots and %d deltas, expected %d and 1", base.Ballots, len(deltaKeys), maxCounterDeltas)
+	}
+}
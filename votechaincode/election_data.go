@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ElectionData is the metadata of an election as submitted with
+// initializationInvokation and returned by electionDataQuery. An election
+// either has Contests or is a single contest described by its own
+// ContestRules.
+type ElectionData struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Info        string `json:"info,omitempty"`
+	StartDate   int64  `json:"startDate"`
+	EndDate     int64  `json:"endDate"`
+	VoterCount  int    `json:"voterCount"`
+	ContestRules
+	Contests     []Contest       `json:"contests,omitempty"`
+	EndCondition AnyEndCondition `json:"endCondition"`
+
+	// Weights makes the election weighted. Every ballot then counts with
+	// the weight of its voter.
+	Weights *WeightSource `json:"weights,omitempty"`
+
+	// CommitReveal makes voters commit to their ballot while voting is
+	// open and reveal it once voting is over.
+	CommitReveal *CommitReveal `json:"commitReveal,omitempty"`
+	// Encryption makes voters submit encrypted ballots that are only
+	// decrypted as a sum by the trustees.
+	Encryption *Encryption `json:"encryption,omitempty"`
+	// PrivateData keeps the ballots in a private data collection with only
+	// their hashes on the channel ledger.
+	PrivateData *PrivateData `json:"privateData,omitempty"`
+
+	// ExtendEndDateOnPause moves endDate by the length of every pause when
+	// the election is resumed. Without it a paused election closes at
+	// endDate.
+	ExtendEndDateOnPause bool `json:"extendEndDateOnPause,omitempty"`
+}
+
+// Candidate is a single option voters can choose. ID is stable for the
+// lifetime of the election and is what ballots refer to.
+type Candidate struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Violation describes a single rule an ElectionData payload breaks.
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every Violation of a rejected payload. Its
+// Error string is JSON so clients can display each violation separately.
+type ValidationError struct {
+	Violations []Violation `json:"violations"`
+}
+
+func (v *ValidationError) add(field, message string) {
+	v.Violations = append(v.Violations, Violation{Field: field, Message: message})
+}
+
+func (v *ValidationError) Error() string {
+	out, err := json.Marshal(struct {
+		Message    string      `json:"message"`
+		Violations []Violation `json:"violations"`
+	}{"Invalid ElectionData", v.Violations})
+	if err != nil {
+		return "Invalid ElectionData"
+	}
+	return string(out)
+}
+
+// parseElectionData strictly decodes and validates an ElectionData payload.
+// The returned error is a *ValidationError listing every violation.
+func parseElectionData(data []byte) (*ElectionData, error) {
+	var electionData ElectionData
+	err := decodeStrict(data, &electionData)
+	if err != nil {
+		verr := &ValidationError{}
+		field := ""
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+			field = typeErr.Field
+		}
+		verr.add(field, err.Error())
+		return nil, verr
+	}
+
+	electionData.assignCandidateIDs()
+	for i := range electionData.Contests {
+		electionData.Contests[i].assignCandidateIDs()
+	}
+	verr := electionData.validate()
+	if verr != nil {
+		return nil, verr
+	}
+	return &electionData, nil
+}
+
+// decodeStrict unmarshals a single JSON value, rejecting unknown fields and
+// trailing data.
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err != nil {
+		return err
+	}
+	// More doesn't see a stray closing bracket, Token does.
+	_, err = decoder.Token()
+	if err != io.EOF {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
+
+// validate checks the field and cross-field rules of an ElectionData and
+// returns nil if there are no violations.
+func (e *ElectionData) validate() *ValidationError {
+	verr := &ValidationError{}
+
+	if strings.TrimSpace(e.Title) == "" {
+		verr.add("title", "must not be empty")
+	}
+	if e.StartDate <= 0 {
+		verr.add("startDate", "must be a positive unix timestamp")
+	}
+	if e.EndDate <= 0 {
+		verr.add("endDate", "must be a positive unix timestamp")
+	}
+	if e.StartDate > 0 && e.EndDate > 0 && e.StartDate >= e.EndDate {
+		verr.add("endDate", "must be after startDate")
+	}
+	if e.VoterCount <= 0 {
+		verr.add("voterCount", "must be greater than 0")
+	}
+
+	if len(e.Contests) == 0 {
+		e.ContestRules.validate("", verr)
+	} else {
+		e.validateContests(verr)
+	}
+
+	validateEndCondition(e.EndCondition, e, "endCondition", verr)
+	if e.Weights != nil {
+		e.Weights.validate(e, "weights", verr)
+	}
+	if e.CommitReveal != nil {
+		e.CommitReveal.validate("commitReveal", verr)
+	}
+	if e.Encryption != nil {
+		e.Encryption.validate(e, "encryption", verr)
+	}
+	if e.PrivateData != nil {
+		e.PrivateData.validate(e, "privateData", verr)
+	}
+	// A condition that holds before any ballot, such as the negation of a
+	// vote count, would close the election as it opens.
+	if len(verr.Violations) == 0 && e.EndCondition.reached(&EndConditionState{ElectionData: e, Counters: newCounters(), Now: e.StartDate}) {
+		verr.add("endCondition", "is reached before the first ballot")
+	}
+
+	if len(verr.Violations) == 0 {
+		return nil
+	}
+	return verr
+}
+
+// assignCandidateIDs gives every candidate without an ID one derived from
+// its name.
+func (e *ContestRules) assignCandidateIDs() {
+	for i := range e.Candidates {
+		if e.Candidates[i].ID == "" {
+			e.Candidates[i].ID = e.newCandidateID(e.Candidates[i].Name)
+		}
+	}
+}
+
+// newCandidateID derives a readable ID like "alice-smith" from a candidate
+// name that is not used by any candidate of the contest yet.
+func (e *ContestRules) newCandidateID(name string) string {
+	var slug []rune
+	for _, c := range normalizeName(name) {
+		switch {
+		case c >= 'a' && c <= 'z' || c >= '0' && c <= '9':
+			slug = append(slug, c)
+		case len(slug) > 0 && slug[len(slug)-1] != '-':
+			slug = append(slug, '-')
+		}
+	}
+	base := strings.Trim(string(slug), "-")
+	if len(base) > maxIDLength-4 {
+		base = strings.Trim(base[:maxIDLength-4], "-")
+	}
+	if base == "" {
+		base = "candidate"
+	}
+
+	id := base
+	for n := 2; e.candidateIndex(id) != -1; n++ {
+		id = base + "-" + strconv.Itoa(n)
+	}
+	return id
+}
+
+// seats returns the number of candidates the contest elects.
+func (e *ContestRules) seats() int {
+	if e.Seats == 0 {
+		return 1
+	}
+	return e.Seats
+}
+
+// candidateIndex returns the position of the candidate with the given ID or
+// -1 if there is none.
+func (e *ContestRules) candidateIndex(candidateID string) int {
+	for i, candidate := range e.Candidates {
+		if candidate.ID == candidateID {
+			return i
+		}
+	}
+	return -1
+}
+
+// votesHidden reports whether the choices of voters are unknown until the
+// election is tallied.
+func (e *ElectionData) votesHidden() bool {
+	return e.CommitReveal != nil || e.Encryption != nil || e.PrivateData != nil
+}
+
+// normalizeName folds case and surrounding whitespace so that names like
+// "Alice" and "alice " compare equal.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
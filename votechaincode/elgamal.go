@@ -0,0 +1,323 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Encrypted elections use exponential ElGamal on P-256. A vote m is
+// encrypted under the public key Y as (A, B) = (rG, mG + rY), so adding
+// ciphertexts adds the votes. Points are hex encoded in uncompressed form,
+// the point at infinity as "00". Scalars are hex encoded big-endian
+// integers.
+var curve = elliptic.P256()
+
+const identityEncoding = "00"
+
+// ecPoint is a point on curve. The point at infinity has X == nil.
+type ecPoint struct {
+	X, Y *big.Int
+}
+
+var identity = ecPoint{}
+
+// Ciphertext is an exponential ElGamal ciphertext.
+type Ciphertext struct {
+	A string `json:"a"`
+	B string `json:"b"`
+}
+
+// ciphertext is a decoded Ciphertext.
+type ciphertext struct {
+	A, B ecPoint
+}
+
+func basePoint() ecPoint {
+	return ecPoint{curve.Params().Gx, curve.Params().Gy}
+}
+
+func (p ecPoint) isIdentity() bool {
+	return p.X == nil
+}
+
+func (p ecPoint) equal(q ecPoint) bool {
+	if p.isIdentity() || q.isIdentity() {
+		return p.isIdentity() && q.isIdentity()
+	}
+	return p.X.Cmp(q.X) == 0 && p.Y.Cmp(q.Y) == 0
+}
+
+func (p ecPoint) add(q ecPoint) ecPoint {
+	switch {
+	case p.isIdentity():
+		return q
+	case q.isIdentity():
+		return p
+	case p.equal(q):
+		return p.mul(big.NewInt(2))
+	case p.equal(q.neg()):
+		return identity
+	}
+	x, y := curve.Add(p.X, p.Y, q.X, q.Y)
+	return ecPoint{x, y}
+}
+
+func (p ecPoint) neg() ecPoint {
+	if p.isIdentity() {
+		return p
+	}
+	return ecPoint{p.X, new(big.Int).Sub(curve.Params().P, p.Y)}
+}
+
+func (p ecPoint) sub(q ecPoint) ecPoint {
+	return p.add(q.neg())
+}
+
+// mul returns kP. k is reduced modulo the group order.
+func (p ecPoint) mul(k *big.Int) ecPoint {
+	k = new(big.Int).Mod(k, curve.Params().N)
+	if p.isIdentity() || k.Sign() == 0 {
+		return identity
+	}
+	x, y := curve.ScalarMult(p.X, p.Y, k.Bytes())
+	return ecPoint{x, y}
+}
+
+func (p ecPoint) bytes() []byte {
+	if p.isIdentity() {
+		return []byte{0}
+	}
+	return elliptic.Marshal(curve, p.X, p.Y)
+}
+
+func (p ecPoint) encode() string {
+	return hex.EncodeToString(p.bytes())
+}
+
+// decodePoint decodes a point and checks that it is on the curve.
+func decodePoint(encoded string) (ecPoint, error) {
+	if encoded == identityEncoding {
+		return identity, nil
+	}
+	data, err := hex.DecodeString(encoded)
+	if err != nil {
+		return identity, errors.New("point isn't hex encoded")
+	}
+	x, y := elliptic.Unmarshal(curve, data)
+	if x == nil || !curve.IsOnCurve(x, y) {
+		return identity, errors.New("point isn't on the curve")
+	}
+	return ecPoint{x, y}, nil
+}
+
+// decodeScalar decodes a scalar and checks that it is smaller than the group
+// order.
+func decodeScalar(encoded string) (*big.Int, error) {
+	data, err := hex.DecodeString(encoded)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("scalar isn't hex encoded")
+	}
+	k := new(big.Int).SetBytes(data)
+	if k.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("scalar isn't smaller than the group order")
+	}
+	return k, nil
+}
+
+func encodeScalar(k *big.Int) string {
+	return hex.EncodeToString(k.Bytes())
+}
+
+func (c Ciphertext) decode() (ciphertext, error) {
+	a, err := decodePoint(c.A)
+	if err != nil {
+		return ciphertext{}, err
+	}
+	b, err := decodePoint(c.B)
+	if err != nil {
+		return ciphertext{}, err
+	}
+	return ciphertext{a, b}, nil
+}
+
+func (c ciphertext) encode() Ciphertext {
+	return Ciphertext{A: c.A.encode(), B: c.B.encode()}
+}
+
+func (c ciphertext) add(other ciphertext) ciphertext {
+	return ciphertext{c.A.add(other.A), c.B.add(other.B)}
+}
+
+func (c ciphertext) mul(k *big.Int) ciphertext {
+	return ciphertext{c.A.mul(k), c.B.mul(k)}
+}
+
+// hashToScalar derives a Fiat–Shamir challenge from a domain label and the
+// points of a proof.
+func hashToScalar(label string, points ...ecPoint) *big.Int {
+	hash := sha256.New()
+	hash.Write([]byte(label))
+	for _, point := range points {
+		hash.Write(point.bytes())
+	}
+	return new(big.Int).Mod(new(big.Int).SetBytes(hash.Sum(nil)), curve.Params().N)
+}
+
+// bindLabel extends a Fiat–Shamir domain label with the context a proof is
+// bound to. Every part is prefixed with its length so that different
+// contexts never give the same label.
+func bindLabel(label string, context ...string) string {
+	for _, part := range context {
+		label += "|" + strconv.Itoa(len(part)) + ":" + part
+	}
+	return label
+}
+
+// SchnorrProof proves knowledge of the logarithm x of H = xG. The prover
+// picks a random w, computes the commitment a = wG, the challenge
+// c = hashToScalar(label, G, H, a) and the response z = w + cx.
+type SchnorrProof struct {
+	Challenge string `json:"challenge"`
+	Response  string `json:"response"`
+}
+
+// verify checks the proof for H = xG.
+func (p SchnorrProof) verify(label string, h ecPoint) error {
+	c, z, err := ChaumPedersenProof(p).decode()
+	if err != nil {
+		return err
+	}
+	g := basePoint()
+	if hashToScalar(label, g, h, g.mul(z).sub(h.mul(c))).Cmp(c) != 0 {
+		return errors.New("proof doesn't verify")
+	}
+	return nil
+}
+
+// ChaumPedersenProof proves that log_G(H) equals log_A(D) without revealing
+// the logarithm x. The prover picks a random w, computes the commitments
+// a1 = wG and a2 = wA, the challenge c = hashToScalar(label, G, H, A, D,
+// a1, a2) and the response z = w + cx.
+type ChaumPedersenProof struct {
+	Challenge string `json:"challenge"`
+	Response  string `json:"response"`
+}
+
+func (p ChaumPedersenProof) decode() (c, z *big.Int, err error) {
+	c, err = decodeScalar(p.Challenge)
+	if err != nil {
+		return nil, nil, errors.New("challenge: " + err.Error())
+	}
+	z, err = decodeScalar(p.Response)
+	if err != nil {
+		return nil, nil, errors.New("response: " + err.Error())
+	}
+	return c, z, nil
+}
+
+// verify checks the proof for H = xG and D = xA.
+func (p ChaumPedersenProof) verify(label string, h, a, d ecPoint) error {
+	c, z, err := p.decode()
+	if err != nil {
+		return err
+	}
+	g := basePoint()
+	a1 := g.mul(z).sub(h.mul(c))
+	a2 := a.mul(z).sub(d.mul(c))
+	if hashToScalar(label, g, h, a, d, a1, a2).Cmp(c) != 0 {
+		return errors.New("proof doesn't verify")
+	}
+	return nil
+}
+
+// DisjunctiveProof proves that a ciphertext (A, B) under the public key Y
+// encrypts one of a list of values without revealing which, with one
+// Chaum–Pedersen branch per value v showing log_G(A) = log_Y(B - vG). For
+// the encrypted value m = v_j with randomness r the prover picks a random w
+// and, for every other branch i, a random challenge c_i and response z_i.
+// The commitments are a1_j = wG and a2_j = wY for the real branch and
+// a1_i = z_iG - c_iA and a2_i = z_iY - c_i(B - v_iG) for the others. With
+// c = hashToScalar(label, G, Y, A, B, a1_0, a2_0, a1_1, a2_1, ...) the real
+// branch gets c_j = c - sum of the other c_i and z_j = w + c_jr.
+type DisjunctiveProof []ChaumPedersenProof
+
+// verify checks that the proof shows c encrypts one of values under y.
+func (p DisjunctiveProof) verify(label string, y ecPoint, c ciphertext, values []int) error {
+	if len(p) != len(values) {
+		return errors.New("expecting one branch per possible value")
+	}
+	g := basePoint()
+	points := []ecPoint{g, y, c.A, c.B}
+	sum := new(big.Int)
+	for i, branch := range p {
+		challenge, response, err := branch.decode()
+		if err != nil {
+			return err
+		}
+		d := c.B.sub(g.mul(big.NewInt(int64(values[i]))))
+		points = append(points, g.mul(response).sub(c.A.mul(challenge)), y.mul(response).sub(d.mul(challenge)))
+		sum.Add(sum, challenge)
+	}
+	if hashToScalar(label, points...).Cmp(sum.Mod(sum, curve.Params().N)) != 0 {
+		return errors.New("proof doesn't verify")
+	}
+	return nil
+}
+
+// lagrangeCoefficient returns the coefficient of the share with index i
+// when interpolating the shares of indices at x.
+func lagrangeCoefficient(indices []int, i, x int) *big.Int {
+	n := curve.Params().N
+	numerator := big.NewInt(1)
+	denominator := big.NewInt(1)
+	for _, j := range indices {
+		if j == i {
+			continue
+		}
+		numerator.Mul(numerator, big.NewInt(int64(x-j)))
+		numerator.Mod(numerator, n)
+		denominator.Mul(denominator, big.NewInt(int64(i-j)))
+		denominator.Mod(denominator, n)
+	}
+	return numerator.Mul(numerator, new(big.Int).ModInverse(denominator, n)).Mod(numerator, n)
+}
+
+// interpolate returns the point at x of the polynomial in the exponent
+// given by the points of indices.
+func interpolate(indices []int, points []ecPoint, x int) ecPoint {
+	result := identity
+	for k, i := range indices {
+		result = result.add(points[k].mul(lagrangeCoefficient(indices, i, x)))
+	}
+	return result
+}
+
+// discreteLog returns m with mG == point for m up to max. It takes baby
+// steps jG for j < s, with s*s > max, and then giant steps point - isG
+// until one of them is a baby step, so it needs about 2*sqrt(max) point
+// additions instead of max.
+func discreteLog(point ecPoint, max int) (int, error) {
+	g := basePoint()
+	s := int(math.Sqrt(float64(max))) + 1
+	babySteps := make(map[string]int, s)
+	current := identity
+	for j := 0; j < s; j++ {
+		babySteps[string(current.bytes())] = j
+		current = current.add(g)
+	}
+	// current is sG now.
+	giantStep := current.neg()
+	current = point
+	for i := 0; i < s; i++ {
+		if j, ok := babySteps[string(current.bytes())]; ok && i*s+j <= max {
+			return i*s + j, nil
+		}
+		current = current.add(giantStep)
+	}
+	return 0, errors.New("decrypted value out of range")
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+)
+
+const testLabel = "vote/test"
+
+func randomScalar(t *testing.T) *big.Int {
+	k, err := rand.Int(rand.Reader, curve.Params().N)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// encrypt encrypts m under y with randomness r.
+func encrypt(y ecPoint, m int, r *big.Int) ciphertext {
+	g := basePoint()
+	return ciphertext{g.mul(r), g.mul(big.NewInt(int64(m))).add(y.mul(r))}
+}
+
+// proveEqualLogs proves H = xG and D = xA.
+func proveEqualLogs(t *testing.T, label string, x *big.Int, a ecPoint) ChaumPedersenProof {
+	g := basePoint()
+	w := randomScalar(t)
+	c := hashToScalar(label, g, g.mul(x), a, a.mul(x), g.mul(w), a.mul(w))
+	z := new(big.Int).Add(w, new(big.Int).Mul(c, x))
+	return ChaumPedersenProof{Challenge: encodeScalar(c), Response: encodeScalar(z.Mod(z, curve.Params().N))}
+}
+
+// proveOneOf proves that c, encrypted under y with randomness r, encrypts one
+// of values by taking the branch of values[actual] as the actual one. The proof
+// only verifies if c actually encrypts values[actual].
+func proveOneOf(t *testing.T, label string, y ecPoint, c ciphertext, r *big.Int, values []int, actual int) DisjunctiveProof {
+	g := basePoint()
+	n := curve.Params().N
+	challenges := make([]*big.Int, len(values))
+	responses := make([]*big.Int, len(values))
+	points := []ecPoint{g, y, c.A, c.B}
+	w := randomScalar(t)
+	sum := new(big.Int)
+	for i, value := range values {
+		if i == actual {
+			points = append(points, g.mul(w), y.mul(w))
+			continue
+		}
+		challenges[i], responses[i] = randomScalar(t), randomScalar(t)
+		d := c.B.sub(g.mul(big.NewInt(int64(value))))
+		points = append(points, g.mul(responses[i]).sub(c.A.mul(challenges[i])), y.mul(responses[i]).sub(d.mul(challenges[i])))
+		sum.Add(sum, challenges[i])
+	}
+	challenges[actual] = new(big.Int).Sub(hashToScalar(label, points...), sum)
+	challenges[actual].Mod(challenges[actual], n)
+	responses[actual] = new(big.Int).Add(w, new(big.Int).Mul(challenges[actual], r))
+	responses[actual].Mod(responses[actual], n)
+
+	proof := make(DisjunctiveProof, len(values))
+	for i := range values {
+		proof[i] = ChaumPedersenProof{Challenge: encodeScalar(challenges[i]), Response: encodeScalar(responses[i])}
+	}
+	return proof
+}
+
+func TestChaumPedersenProofRoundTrip(t *testing.T) {
+	g := basePoint()
+	x := randomScalar(t)
+	a := g.mul(randomScalar(t))
+	proof := proveEqualLogs(t, testLabel, x, a)
+
+	err := proof.verify(testLabel, g.mul(x), a, a.mul(x))
+	if err != nil {
+		t.Fatalf("valid proof rejected: %v", err)
+	}
+	if proof.verify("vote/other", g.mul(x), a, a.mul(x)) == nil {
+		t.Error("proof verified under another label")
+	}
+	other := new(big.Int).Add(x, big.NewInt(1))
+	if proof.verify(testLabel, g.mul(x), a, a.mul(other)) == nil {
+		t.Error("proof verified for unequal logarithms")
+	}
+	if (ChaumPedersenProof{Challenge: proof.Challenge, Response: "zz"}).verify(testLabel, g.mul(x), a, a.mul(x)) == nil {
+		t.Error("proof with a malformed response verified")
+	}
+}
+
+func TestSchnorrProofRoundTrip(t *testing.T) {
+	g := basePoint()
+	x := randomScalar(t)
+	label := bindLabel(testLabel, "e", "t1")
+	w := randomScalar(t)
+	c := hashToScalar(label, g, g.mul(x), g.mul(w))
+	z := new(big.Int).Add(w, new(big.Int).Mul(c, x))
+	proof := SchnorrProof{Challenge: encodeScalar(c), Response: encodeScalar(z.Mod(z, curve.Params().N))}
+
+	err := proof.verify(label, g.mul(x))
+	if err != nil {
+		t.Fatalf("valid proof rejected: %v", err)
+	}
+	if proof.verify(bindLabel(testLabel, "e", "t2"), g.mul(x)) == nil {
+		t.Error("proof verified for another trustee")
+	}
+	if proof.verify(label, g.mul(x).add(g)) == nil {
+		t.Error("proof verified for another key")
+	}
+}
+
+func TestBindLabel(t *testing.T) {
+	if bindLabel(testLabel, "a|1:b") == bindLabel(testLabel, "a", "b") {
+		t.Error("different contexts give the same label")
+	}
+	if bindLabel(testLabel, "ab", "") == bindLabel(testLabel, "a", "b") {
+		t.Error("different contexts give the same label")
+	}
+}
+
+func TestDisjunctiveProofRoundTrip(t *testing.T) {
+	y := basePoint().mul(randomScalar(t))
+	values := []int{0, 1}
+	for _, m := range values {
+		r := randomScalar(t)
+		c := encrypt(y, m, r)
+		proof := proveOneOf(t, testLabel, y, c, r, values, m)
+
+		err := proof.verify(testLabel, y, c, values)
+		if err != nil {
+			t.Errorf("proof for %d rejected: %v", m, err)
+		}
+		if proof.verify("vote/other", y, c, values) == nil {
+			t.Errorf("proof for %d verified under another label", m)
+		}
+		if proof[:1].verify(testLabel, y, c, values[:1]) == nil {
+			t.Errorf("truncated proof for %d verified", m)
+		}
+	}
+}
+
+// A voter encrypting 2 can't prove the ciphertext encrypts 0 or 1, whichever
+// branch is faked.
+func TestDisjunctiveProofRejectsValueOutOfRange(t *testing.T) {
+	y := basePoint().mul(randomScalar(t))
+	values := []int{0, 1}
+	r := randomScalar(t)
+	c := encrypt(y, 2, r)
+	for actual := range values {
+		proof := proveOneOf(t, testLabel, y, c, r, values, actual)
+		if proof.verify(testLabel, y, c, values) == nil {
+			t.Errorf("proof for 2 with actual branch %d verified", actual)
+		}
+	}
+	proof := proveOneOf(t, testLabel, y, c, r, []int{0, 2}, 1)
+	if proof.verify(testLabel, y, c, []int{0, 2}) != nil {
+		t.Error("proof for 2 among 0 and 2 rejected")
+	}
+	if proof.verify(testLabel, y, c, values) == nil {
+		t.Error("proof for 2 among 0 and 2 verified for 0 and 1")
+	}
+}
+
+func TestDiscreteLog(t *testing.T) {
+	g := basePoint()
+	for _, max := range []int{0, 1, 2, 15, 16, 17, 1000} {
+		for _, m := range []int{0, 1, max / 2, max - 1, max} {
+			if m < 0 || m > max {
+				continue
+			}
+			found, err := discreteLog(g.mul(big.NewInt(int64(m))), max)
+			if err != nil || found != m {
+				t.Errorf("discreteLog of %d up to %d: %d, %v", m, max, found, err)
+			}
+		}
+		_, err := discreteLog(g.mul(big.NewInt(int64(max+1))), max)
+		if err == nil {
+			t.Errorf("discreteLog of %d up to %d didn't fail", max+1, max)
+		}
+	}
+}
+
+// Threshold decryption with any threshold of the shares of a secret x
+// recovers mG from the ciphertext.
+func TestThresholdDecryption(t *testing.T) {
+	g := basePoint()
+	coefficients := []*big.Int{randomScalar(t), randomScalar(t)}
+	share := func(i int) *big.Int {
+		x := new(big.Int).Set(coefficients[1])
+		x.Mul(x, big.NewInt(int64(i)))
+		x.Add(x, coefficients[0])
+		return x.Mod(x, curve.Params().N)
+	}
+	y := g.mul(coefficients[0])
+	c := encrypt(y, 7, randomScalar(t))
+
+	for _, indices := range [][]int{{1, 2}, {1, 3}, {3, 2}} {
+		partials := make([]ecPoint, len(indices))
+		for k, i := range indices {
+			partials[k] = c.A.mul(share(i))
+		}
+		m, err := discreteLog(c.B.sub(interpolate(indices, partials, 0)), 10)
+		if err != nil || m != 7 {
+			t.Errorf("decryption with shares %v: %d, %v", indices, m, err)
+		}
+	}
+}
@@ -0,0 +1,867 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// The encrypted running tally is kept like the vote counters: a compacted
+// base plus one delta per vote, folded by evaluateEndCondition.
+const (
+	encryptedTallyObjectType      = "enctally"
+	encryptedTallyDeltaObjectType = "enctallydelta"
+	decryptionShareObjectType     = "decshare"
+	decryptedTallyObjectType      = "dectally"
+	// Every ciphertext cast is recorded under its A so that none is cast
+	// twice.
+	ciphertextObjectType = "ciphertext"
+)
+
+// Fiat–Shamir domains of the proofs of partial decryptions and of the
+// validity proofs of encrypted ballots. Ballot proofs are bound to the
+// election, the voter and the candidate key or, for sum proofs, the contest,
+// and decryption proofs to the election, the trustee and the candidate key,
+// so they can't be replayed anywhere else.
+const (
+	decryptionLabel  = "vote/partial-decryption"
+	ballotProofLabel = "vote/ballot-validity"
+)
+
+// Encryption makes the election an encrypted election. Ballots then carry
+// one Ciphertext of 0 or 1 per candidate, encrypted under PublicKey, and
+// proofs that they are valid. They are added into an encrypted running
+// tally and never decrypted one by one.
+// The private key is shared among the Trustees with a Shamir threshold
+// scheme: the share of the trustee with Index i is f(i) for a polynomial f
+// of degree Threshold-1 with f(0) the private key, and PublicShare is
+// f(i)G. Any Threshold trustees can decrypt the tally.
+//
+// With KeyCeremony the trustees generate the key among themselves instead
+// and PublicKey and the public shares are left empty. finishKeyCeremony
+// fills them in and lists the trustees whose dealings make up the key as
+// Dealers. ComplaintPeriod is the number of seconds the other trustees have
+// to complain about the shares of a dealer once they were dealt;
+// finishKeyCeremony waits for it to pass for every dealing.
+type Encryption struct {
+	PublicKey   string    `json:"publicKey,omitempty"`
+	Threshold   int       `json:"threshold"`
+	Trustees    []Trustee `json:"trustees"`
+	KeyCeremony bool      `json:"keyCeremony,omitempty"`
+	Dealers     []string  `json:"dealers,omitempty"`
+
+	ComplaintPeriod int64 `json:"complaintPeriod,omitempty"`
+}
+
+// Trustee holds a share of the private key of an encrypted election. ID is
+// the identity the trustee submits their decryption share with.
+type Trustee struct {
+	ID          string `json:"id"`
+	Index       int    `json:"index"`
+	PublicShare string `json:"publicShare,omitempty"`
+}
+
+// EncryptedTally is the sum of the ciphertexts of all counted ballots by
+// candidate, named like in Counters.
+type EncryptedTally struct {
+	Ciphertexts map[string]Ciphertext `json:"ciphertexts"`
+}
+
+// PartialDecryption is D = xA for the share x of a trustee and the A of a
+// ciphertext of the encrypted tally, with a proof that the same x was used
+// for the trustee's PublicShare.
+type PartialDecryption struct {
+	D     string             `json:"d"`
+	Proof ChaumPedersenProof `json:"proof"`
+}
+
+// DecryptionShare is the partial decryption of the whole encrypted tally by
+// one trustee.
+type DecryptionShare struct {
+	TrusteeID   string                       `json:"trusteeID"`
+	Index       int                          `json:"index"`
+	Shares      map[string]PartialDecryption `json:"shares"`
+	SubmittedAt int64                        `json:"submittedAt"`
+	TxID        string                       `json:"txID"`
+}
+
+// DecryptedTally are the counts decryptTally combined from the decryption
+// shares of Trustees.
+type DecryptedTally struct {
+	Counts      map[string]int `json:"counts"`
+	Trustees    []string       `json:"trustees"`
+	DecryptedAt int64          `json:"decryptedAt"`
+	TxID        string         `json:"txID"`
+}
+
+func (e *Encryption) validate(electionData *ElectionData, field string, verr *ValidationError) {
+	// The keys of a pending key ceremony don't exist yet.
+	pending := e.keyCeremonyPending()
+	var publicKey ecPoint
+	var err error
+	if pending {
+		if len(e.Dealers) > 0 {
+			verr.add(field+".dealers", "must be empty until the key ceremony finished")
+		}
+	} else {
+		publicKey, err = decodePoint(e.PublicKey)
+		if err != nil {
+			verr.add(field+".publicKey", err.Error())
+		} else if publicKey.isIdentity() {
+			verr.add(field+".publicKey", "must not be the point at infinity")
+		}
+		if !e.KeyCeremony && len(e.Dealers) > 0 {
+			verr.add(field+".dealers", "only set by the key ceremony")
+		}
+	}
+	if e.KeyCeremony && e.ComplaintPeriod <= 0 {
+		verr.add(field+".complaintPeriod", "must be greater than 0 for a key ceremony")
+	} else if !e.KeyCeremony && e.ComplaintPeriod != 0 {
+		verr.add(field+".complaintPeriod", "only used by the key ceremony")
+	}
+	if len(e.Trustees) == 0 {
+		verr.add(field+".trustees", "must contain at least one trustee")
+	}
+	if e.Threshold < 1 || e.Threshold > len(e.Trustees) {
+		verr.add(field+".threshold", "must be between 1 and the number of trustees")
+	}
+
+	valid := err == nil
+	seenIDs := make(map[string]int)
+	seenIndices := make(map[int]int)
+	indices := make([]int, len(e.Trustees))
+	shares := make([]ecPoint, len(e.Trustees))
+	for i, trustee := range e.Trustees {
+		trusteeField := field + ".trustees[" + strconv.Itoa(i) + "]"
+		if trustee.ID == "" {
+			verr.add(trusteeField+".id", "must not be empty")
+		} else if first, ok := seenIDs[trustee.ID]; ok {
+			verr.add(trusteeField+".id", "duplicates trustees["+strconv.Itoa(first)+"]")
+		} else {
+			seenIDs[trustee.ID] = i
+		}
+		if trustee.Index < 1 || trustee.Index > len(e.Trustees) {
+			verr.add(trusteeField+".index", "must be between 1 and the number of trustees")
+			valid = false
+		} else if first, ok := seenIndices[trustee.Index]; ok {
+			verr.add(trusteeField+".index", "duplicates trustees["+strconv.Itoa(first)+"]")
+			valid = false
+		} else {
+			seenIndices[trustee.Index] = i
+		}
+		indices[i] = trustee.Index
+		if pending {
+			if trustee.PublicShare != "" {
+				verr.add(trusteeField+".publicShare", "must be empty until the key ceremony finished")
+			}
+			continue
+		}
+		shares[i], err = decodePoint(trustee.PublicShare)
+		if err != nil {
+			verr.add(trusteeField+".publicShare", err.Error())
+			valid = false
+		}
+	}
+
+	// Every public share and the public key must lie on the same polynomial
+	// of degree threshold-1, given by the first threshold shares.
+	if !pending && valid && e.Threshold >= 1 && e.Threshold <= len(e.Trustees) {
+		t := e.Threshold
+		if !interpolate(indices[:t], shares[:t], 0).equal(publicKey) {
+			verr.add(field+".publicKey", "doesn't match the public shares of the trustees")
+		}
+		for i := t; i < len(e.Trustees); i++ {
+			if !interpolate(indices[:t], shares[:t], indices[i]).equal(shares[i]) {
+				verr.add(field+".trustees["+strconv.Itoa(i)+"].publicShare", "doesn't match the public shares of the other trustees")
+			}
+		}
+	}
+
+	if electionData.CommitReveal != nil {
+		verr.add(field, "can't be combined with commitReveal")
+	}
+	// The ciphertexts of a private election would end up on the channel
+	// ledger anyway, and weighted counts can grow too large to take their
+	// discrete logarithm.
+	if electionData.PrivateData != nil {
+		verr.add(field, "can't be combined with privateData")
+	}
+	if electionData.Weights != nil {
+		verr.add(field, "can't be combined with weights")
+	}
+	for i, contest := range electionData.contests() {
+		contestField := ""
+		if contest.ID != "" {
+			contestField = "contests[" + strconv.Itoa(i) + "]."
+		}
+		method := contest.VotingMethod
+		if method != "" && method != PluralityMethod && method != ApprovalMethod {
+			verr.add(contestField+"votingMethod", "encrypted elections only support plurality and approval voting")
+		}
+		if contest.WriteIns != 0 {
+			verr.add(contestField+"writeIns", "not supported by encrypted elections")
+		}
+	}
+}
+
+// trustee returns the trustee with the given ID or nil.
+func (e *Encryption) trustee(trusteeID string) *Trustee {
+	for i := range e.Trustees {
+		if e.Trustees[i].ID == trusteeID {
+			return &e.Trustees[i]
+		}
+	}
+	return nil
+}
+
+// validateEncryptedAnswer checks that an answer holds a ciphertext and a
+// proof for every candidate of the contest, a sum proof and nothing else.
+// The proofs themselves are checked by verifyEncryptedBallot.
+func validateEncryptedAnswer(rules *ContestRules, answer *Ballot) error {
+	err := answer.expectFields("encrypted", "proofs", "sumProof")
+	if err != nil {
+		return err
+	}
+	if len(answer.Encrypted) != len(rules.Candidates) {
+		return errors.New("expecting one ciphertext per candidate")
+	}
+	if len(answer.Proofs) != len(rules.Candidates) {
+		return errors.New("expecting one proof per candidate")
+	}
+	if len(answer.SumProof) == 0 {
+		return errors.New("expecting a sum proof")
+	}
+	for _, candidate := range rules.Candidates {
+		encrypted, ok := answer.Encrypted[candidate.ID]
+		if !ok {
+			return errors.New("no ciphertext for candidate \"" + candidate.ID + "\"")
+		}
+		_, err = encrypted.decode()
+		if err != nil {
+			return errors.New("ciphertext for candidate \"" + candidate.ID + "\": " + err.Error())
+		}
+		if _, ok := answer.Proofs[candidate.ID]; !ok {
+			return errors.New("no proof for candidate \"" + candidate.ID + "\"")
+		}
+	}
+	return nil
+}
+
+// selectionRange returns the values the sum of an encrypted answer may
+// take: exactly one candidate for plurality, minSelections to maxSelections
+// for approval voting.
+func selectionRange(rules *ContestRules) []int {
+	min, max := 1, 1
+	if rules.VotingMethod == ApprovalMethod {
+		min, max = rules.MinSelections, rules.MaxSelections
+		if max == 0 {
+			max = len(rules.Candidates)
+		}
+	}
+	values := []int{}
+	for value := min; value <= max; value++ {
+		values = append(values, value)
+	}
+	return values
+}
+
+// verifyEncryptedBallot checks the proofs of a validated encrypted ballot
+// cast by voterID: every ciphertext encrypts 0 or 1 and their sum is within
+// the selection limits of the contest.
+func verifyEncryptedBallot(electionID, voterID string, electionData *ElectionData, ballot *Ballot) error {
+	publicKey, err := decodePoint(electionData.Encryption.PublicKey)
+	if err != nil {
+		return err
+	}
+	for _, contest := range electionData.contests() {
+		answer := ballot.answer(contest)
+		if answer.Blank {
+			continue
+		}
+		err = verifyEncryptedAnswer(publicKey, bindLabel(ballotProofLabel, electionID, voterID), contest, answer)
+		if err != nil && contest.ID != "" {
+			return errors.New("contest \"" + contest.ID + "\": " + err.Error())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyEncryptedAnswer checks the proofs of an answer to contest. label is
+// the ballotProofLabel bound to the election and voter.
+func verifyEncryptedAnswer(publicKey ecPoint, label string, contest *Contest, answer *Ballot) error {
+	sum := ciphertext{identity, identity}
+	for _, candidate := range contest.Candidates {
+		encrypted, err := answer.Encrypted[candidate.ID].decode()
+		if err != nil {
+			return err
+		}
+		err = answer.Proofs[candidate.ID].verify(bindLabel(label, contest.candidateKey(candidate.ID)), publicKey, encrypted, []int{0, 1})
+		if err != nil {
+			return errors.New("proof for candidate \"" + candidate.ID + "\": " + err.Error())
+		}
+		sum = sum.add(encrypted)
+	}
+	err := answer.SumProof.verify(bindLabel(label, contest.ID, "sum"), publicKey, sum, selectionRange(&contest.ContestRules))
+	if err != nil {
+		return errors.New("sum proof: " + err.Error())
+	}
+	return nil
+}
+
+// ballotCiphertexts returns what a valid encrypted ballot adds to the
+// encrypted tally.
+func ballotCiphertexts(electionData *ElectionData, ballot *Ballot) (map[string]ciphertext, error) {
+	ciphertexts := make(map[string]ciphertext)
+	for _, contest := range electionData.contests() {
+		answer := ballot.answer(contest)
+		if answer.Blank {
+			continue
+		}
+		for candidateID, encrypted := range answer.Encrypted {
+			decoded, err := encrypted.decode()
+			if err != nil {
+				return nil, err
+			}
+			ciphertexts[contest.candidateKey(candidateID)] = decoded
+		}
+	}
+	return ciphertexts, nil
+}
+
+// putBallotCiphertexts records the ciphertexts of a valid encrypted ballot
+// and fails if one of them was cast in the election before. Its proofs
+// wouldn't verify for another voter, candidate or contest, but the same
+// ciphertext must not be counted twice either.
+func putBallotCiphertexts(stub shim.ChaincodeStubInterface, electionID string, electionData *ElectionData, ballot *Ballot) error {
+	seen := make(map[string]bool)
+	for _, contest := range electionData.contests() {
+		answer := ballot.answer(contest)
+		if answer.Blank {
+			continue
+		}
+		for _, candidate := range contest.Candidates {
+			a := answer.Encrypted[candidate.ID].A
+			key, err := stub.CreateCompositeKey(ciphertextObjectType, []string{electionID, a})
+			if err != nil {
+				return err
+			}
+			stateBytes, err := stub.GetState(key)
+			if err != nil {
+				return errors.New("Failed to get state")
+			}
+			if stateBytes != nil || seen[a] {
+				return errors.New("Ciphertext for candidate \"" + contest.candidateKey(candidate.ID) + "\" was cast before")
+			}
+			seen[a] = true
+			err = stub.PutState(key, []byte(stub.GetTxID()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func encodeCiphertexts(ciphertexts map[string]ciphertext) EncryptedTally {
+	encrypted := EncryptedTally{Ciphertexts: make(map[string]Ciphertext)}
+	for key, c := range ciphertexts {
+		encrypted.Ciphertexts[key] = c.encode()
+	}
+	return encrypted
+}
+
+// addEncryptedTally adds the stored encrypted tally in data to sum.
+func addEncryptedTally(sum map[string]ciphertext, data []byte) error {
+	var encrypted EncryptedTally
+	err := json.Unmarshal(data, &encrypted)
+	if err != nil {
+		return errors.New("Stored encrypted tally couldn't be parsed")
+	}
+	for key, c := range encrypted.Ciphertexts {
+		decoded, err := c.decode()
+		if err != nil {
+			return errors.New("Stored encrypted tally couldn't be parsed")
+		}
+		sum[key] = sum[key].add(decoded)
+	}
+	return nil
+}
+
+// putEncryptedTallyDelta records the delta of the current transaction.
+func putEncryptedTallyDelta(stub shim.ChaincodeStubInterface, electionID string, delta map[string]ciphertext) error {
+	key, err := stub.CreateCompositeKey(encryptedTallyDeltaObjectType, []string{electionID, stub.GetTxID()})
+	if err != nil {
+		return err
+	}
+	deltaJson, err := json.Marshal(encodeCiphertexts(delta))
+	if err != nil {
+		return errors.New("Failed to generate Json")
+	}
+	return stub.PutState(key, deltaJson)
+}
+
+// getEncryptedTally returns the current encrypted tally of an election,
+// i.e. the base plus every delta not compacted yet, and the keys of those
+// deltas.
+func getEncryptedTally(stub shim.ChaincodeStubInterface, electionID string) (map[string]ciphertext, []string, error) {
+	sum := make(map[string]ciphertext)
+	key, err := stub.CreateCompositeKey(encryptedTallyObjectType, []string{electionID})
+	if err != nil {
+		return nil, nil, err
+	}
+	stateBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, nil, errors.New("Failed to get state")
+	}
+	if stateBytes != nil {
+		err = addEncryptedTally(sum, stateBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	stateIterator, err := stub.GetStateByPartialCompositeKey(encryptedTallyDeltaObjectType, []string{electionID})
+	if err != nil {
+		return nil, nil, errors.New("Failed to get StateIterator")
+	}
+	defer stateIterator.Close()
+
+	var deltaKeys []string
+	for stateIterator.HasNext() {
+		queryResponse, err := stateIterator.Next()
+		if err != nil {
+			return nil, nil, errors.New("StateIterator failed to retrieve next Element")
+		}
+		err = addEncryptedTally(sum, queryResponse.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		deltaKeys = append(deltaKeys, queryResponse.Key)
+	}
+	return sum, deltaKeys, nil
+}
+
+// compactEncryptedTally stores the encrypted tally of an election as the new
+// base and deletes the deltas folded into it.
+func compactEncryptedTally(stub shim.ChaincodeStubInterface, electionID string) error {
+	sum, deltaKeys, err := getEncryptedTally(stub, electionID)
+	if err != nil {
+		return err
+	}
+	if len(deltaKeys) == 0 {
+		return nil
+	}
+	key, err := stub.CreateCompositeKey(encryptedTallyObjectType, []string{electionID})
+	if err != nil {
+		return err
+	}
+	sumJson, err := json.Marshal(encodeCiphertexts(sum))
+	if err != nil {
+		return errors.New("Failed to generate Json")
+	}
+	err = stub.PutState(key, sumJson)
+	if err != nil {
+		return err
+	}
+	for _, deltaKey := range deltaKeys {
+		err = stub.DelState(deltaKey)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unspoilEncryptedTally subtracts the ciphertexts of a spoiled ballot from
+// the encrypted tally. Not possible anymore once trustees started to
+// decrypt the tally.
+func unspoilEncryptedTally(stub shim.ChaincodeStubInterface, electionID string, electionData *ElectionData, ballot *Ballot) error {
+	shares, _, err := getDecryptionShares(stub, electionID)
+	if err != nil {
+		return err
+	}
+	if len(shares) > 0 {
+		return errors.New("Ballots can't be spoiled once trustees started to decrypt the tally")
+	}
+	ciphertexts, err := ballotCiphertexts(electionData, ballot)
+	if err != nil {
+		return err
+	}
+	for key, c := range ciphertexts {
+		ciphertexts[key] = ciphertext{c.A.neg(), c.B.neg()}
+	}
+	return putEncryptedTallyDelta(stub, electionID, ciphertexts)
+}
+
+// getDecryptionShares returns the decryption shares submitted for an
+// election in key order and the keys they are stored under.
+func getDecryptionShares(stub shim.ChaincodeStubInterface, electionID string) ([]DecryptionShare, []string, error) {
+	stateIterator, err := stub.GetStateByPartialCompositeKey(decryptionShareObjectType, []string{electionID})
+	if err != nil {
+		return nil, nil, errors.New("Failed to get StateIterator")
+	}
+	defer stateIterator.Close()
+
+	shares := []DecryptionShare{}
+	var keys []string
+	for stateIterator.HasNext() {
+		queryResponse, err := stateIterator.Next()
+		if err != nil {
+			return nil, nil, errors.New("StateIterator failed to retrieve next Element")
+		}
+		var share DecryptionShare
+		err = json.Unmarshal(queryResponse.Value, &share)
+		if err != nil {
+			return nil, nil, errors.New("Stored decryption share couldn't be parsed")
+		}
+		shares = append(shares, share)
+		keys = append(keys, queryResponse.Key)
+	}
+	return shares, keys, nil
+}
+
+// getDecryptedTally returns the decrypted tally of an election or nil if
+// the trustees haven't decrypted it yet.
+func getDecryptedTally(stub shim.ChaincodeStubInterface, electionID string) (*DecryptedTally, error) {
+	key, err := stub.CreateCompositeKey(decryptedTallyObjectType, []string{electionID})
+	if err != nil {
+		return nil, err
+	}
+	stateBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get state")
+	}
+	if stateBytes == nil {
+		return nil, nil
+	}
+	var decrypted DecryptedTally
+	err = json.Unmarshal(stateBytes, &decrypted)
+	if err != nil {
+		return nil, errors.New("Stored decrypted tally couldn't be parsed")
+	}
+	return &decrypted, nil
+}
+
+// assertDecrypted returns an error if an encrypted election can't be
+// tallied because its tally hasn't been decrypted.
+func assertDecrypted(stub shim.ChaincodeStubInterface, electionID string, electionData *ElectionData) error {
+	if electionData.Encryption == nil {
+		return nil
+	}
+	decrypted, err := getDecryptedTally(stub, electionID)
+	if err != nil {
+		return err
+	}
+	if decrypted == nil {
+		return errors.New("Encrypted tally hasn't been decrypted yet")
+	}
+	return nil
+}
+
+// deleteEncryption removes the encrypted tally, the decryption shares and
+// the decrypted tally of an election.
+func deleteEncryption(stub shim.ChaincodeStubInterface, electionID string) error {
+	_, keys, err := getEncryptedTally(stub, electionID)
+	if err != nil {
+		return err
+	}
+	_, shareKeys, err := getDecryptionShares(stub, electionID)
+	if err != nil {
+		return err
+	}
+	keys = append(keys, shareKeys...)
+	stateIterator, err := stub.GetStateByPartialCompositeKey(ciphertextObjectType, []string{electionID})
+	if err != nil {
+		return errors.New("Failed to get StateIterator")
+	}
+	defer stateIterator.Close()
+	for stateIterator.HasNext() {
+		queryResponse, err := stateIterator.Next()
+		if err != nil {
+			return errors.New("StateIterator failed to retrieve next Element")
+		}
+		keys = append(keys, queryResponse.Key)
+	}
+	for _, objectType := range []string{encryptedTallyObjectType, decryptedTallyObjectType} {
+		key, err := stub.CreateCompositeKey(objectType, []string{electionID})
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		err = stub.DelState(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tallyDecrypted fills the results of an encrypted contest from the
+// decrypted tally, which may still be nil.
+func tallyDecrypted(contest *Contest, decrypted *DecryptedTally, tally *ContestTally) {
+	if contest.VotingMethod == ApprovalMethod {
+		totals := newTotals(&contest.ContestRules)
+		for i, candidate := range contest.Candidates {
+			if decrypted != nil {
+				totals[i].Marks = decrypted.Counts[contest.candidateKey(candidate.ID)]
+				totals[i].Total = totals[i].Marks
+			}
+		}
+		finishTotals(totals, tally.Valid, tally)
+		return
+	}
+	for i, candidate := range contest.Candidates {
+		if decrypted != nil {
+			tally.Results[i].Votes = decrypted.Counts[contest.candidateKey(candidate.ID)]
+		}
+	}
+	tally.Winners = mostVoted(tally.Results)
+}
+
+// Submit the partial decryption of the encrypted tally by a trustee.
+// Expects the election ID and a JSON object mapping every candidate of the
+// encrypted tally to a PartialDecryption. Only accepted while the election
+// is closed.
+func (t *VoteChaincode) submitDecryptionShare(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID and a JSON string representing the partial decryptions")
+	}
+	electionID := args[0]
+	electionData, lifecycle, err := getElection(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if electionData.Encryption == nil {
+		return shim.Error("Election isn't encrypted")
+	}
+	if lifecycle.State != StateClosed {
+		return shim.Error("Decryption shares can only be submitted while the election is closed")
+	}
+	trusteeID, err := cid.GetID(stub)
+	if err != nil {
+		return shim.Error("Couldn't read ID from stub.")
+	}
+	trustee := electionData.Encryption.trustee(trusteeID)
+	if trustee == nil {
+		return shim.Error("User isn't a trustee of the election")
+	}
+	key, err := stub.CreateCompositeKey(decryptionShareObjectType, []string{electionID, trusteeID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stateBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error("Failed to get state")
+	}
+	if stateBytes != nil {
+		return shim.Error("Trustee already submitted a decryption share")
+	}
+
+	share := DecryptionShare{TrusteeID: trusteeID, Index: trustee.Index}
+	err = decodeStrict([]byte(args[1]), &share.Shares)
+	if err != nil {
+		return shim.Error("Decryption share couldn't be parsed: " + err.Error())
+	}
+	encrypted, _, err := getEncryptedTally(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(share.Shares) != len(encrypted) {
+		return shim.Error("Expecting a partial decryption for every candidate of the encrypted tally")
+	}
+	publicShare, err := decodePoint(trustee.PublicShare)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	candidateKeys := make([]string, 0, len(encrypted))
+	for candidateKey := range encrypted {
+		candidateKeys = append(candidateKeys, candidateKey)
+	}
+	// Sorted so that every peer reports the same error.
+	sort.Strings(candidateKeys)
+	for _, candidateKey := range candidateKeys {
+		partial, ok := share.Shares[candidateKey]
+		if !ok {
+			return shim.Error("No partial decryption for \"" + candidateKey + "\"")
+		}
+		d, err := decodePoint(partial.D)
+		if err != nil {
+			return shim.Error("Partial decryption for \"" + candidateKey + "\": " + err.Error())
+		}
+		err = partial.Proof.verify(bindLabel(decryptionLabel, electionID, trusteeID, candidateKey), publicShare, encrypted[candidateKey].A, d)
+		if err != nil {
+			return shim.Error("Partial decryption for \"" + candidateKey + "\": " + err.Error())
+		}
+	}
+
+	share.SubmittedAt, err = nowUnix(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	share.TxID = stub.GetTxID()
+	shareJson, err := json.Marshal(share)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	err = stub.PutState(key, shareJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("Trustee " + trusteeID + " submitted a decryption share for election " + electionID)
+	return shim.Success(nil)
+}
+
+// Combine the decryption shares of an encrypted election into the final
+// counts once threshold trustees submitted theirs. Expects the election ID.
+// Returns the DecryptedTally.
+func (t *VoteChaincode) decryptTally(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err := cid.AssertAttributeValue(stub, "admin", "true")
+	if err != nil {
+		return shim.Error("User isn't admin")
+	}
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID")
+	}
+	electionID := args[0]
+	electionData, lifecycle, err := getElection(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if electionData.Encryption == nil {
+		return shim.Error("Election isn't encrypted")
+	}
+	if lifecycle.State != StateClosed {
+		return shim.Error("The tally can only be decrypted while the election is closed")
+	}
+	decrypted, err := getDecryptedTally(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if decrypted != nil {
+		return shim.Error("Tally already decrypted")
+	}
+
+	shares, _, err := getDecryptionShares(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	threshold := electionData.Encryption.Threshold
+	if len(shares) < threshold {
+		return shim.Error("Only " + strconv.Itoa(len(shares)) + " of " + strconv.Itoa(threshold) + " decryption shares submitted")
+	}
+	sort.Slice(shares, func(i, j int) bool { return shares[i].Index < shares[j].Index })
+	shares = shares[:threshold]
+	indices := make([]int, threshold)
+	for i, share := range shares {
+		indices[i] = share.Index
+	}
+
+	// The counts can't exceed the number of counted ballots.
+	spoiled, err := spoiledVoteKeys(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	maxCount := 0
+	err = forEachBallot(stub, electionID, electionData, func(key string, value []byte) error {
+		var ballot Ballot
+		if !spoiled[key] && json.Unmarshal(value, &ballot) == nil {
+			maxCount++
+		}
+		return nil
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	encrypted, _, err := getEncryptedTally(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	decrypted = &DecryptedTally{Counts: make(map[string]int), Trustees: []string{}}
+	for _, share := range shares {
+		decrypted.Trustees = append(decrypted.Trustees, share.TrusteeID)
+	}
+	for candidateKey, c := range encrypted {
+		partials := make([]ecPoint, threshold)
+		for i, share := range shares {
+			partials[i], err = decodePoint(share.Shares[candidateKey].D)
+			if err != nil {
+				return shim.Error("Stored decryption share couldn't be parsed")
+			}
+		}
+		count, err := discreteLog(c.B.sub(interpolate(indices, partials, 0)), maxCount)
+		if err != nil {
+			return shim.Error("Couldn't decrypt \"" + candidateKey + "\": " + err.Error())
+		}
+		decrypted.Counts[candidateKey] = count
+	}
+	decrypted.DecryptedAt, err = nowUnix(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	decrypted.TxID = stub.GetTxID()
+
+	decryptedJson, err := json.Marshal(decrypted)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	key, err := stub.CreateCompositeKey(decryptedTallyObjectType, []string{electionID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(key, decryptedJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.SetEvent("TallyDecrypted", decryptedJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(decryptedJson)
+}
+
+// Query the encrypted tally of an election and the decryption shares
+// submitted so far.
+func (t *VoteChaincode) encryptedTallyQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID")
+	}
+	electionData, lifecycle, err := getElection(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if electionData.Encryption == nil {
+		return shim.Error("Election isn't encrypted")
+	}
+	if !lifecycle.hasStarted() {
+		return shim.Error("Election hasn't started yet")
+	}
+
+	encrypted, _, err := getEncryptedTally(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	shares, _, err := getDecryptionShares(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	resultJson, err := json.Marshal(struct {
+		EncryptedTally
+		Shares []DecryptionShare `json:"shares"`
+	}{encodeCiphertexts(encrypted), shares})
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	return shim.Success(resultJson)
+}
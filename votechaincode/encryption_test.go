@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// testKeys is an election key shared among trustees with the indices 1 to
+// len(shares) by a random polynomial.
+type testKeys struct {
+	shares    []*big.Int
+	publicKey ecPoint
+}
+
+func newTestKeys(t *testing.T, trustees, threshold int) *testKeys {
+	coefficients := make([]*big.Int, threshold)
+	for i := range coefficients {
+		coefficients[i] = randomScalar(t)
+	}
+	keys := &testKeys{publicKey: basePoint().mul(coefficients[0])}
+	for i := 1; i <= trustees; i++ {
+		keys.shares = append(keys.shares, evaluatePolynomial(coefficients, i))
+	}
+	return keys
+}
+
+// evaluatePolynomial returns the polynomial with coefficients at x.
+func evaluatePolynomial(coefficients []*big.Int, x int) *big.Int {
+	y := new(big.Int)
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y.Mul(y, big.NewInt(int64(x)))
+		y.Add(y, coefficients[i])
+	}
+	return y.Mod(y, curve.Params().N)
+}
+
+// encryptionJson returns the encryption field of an election whose
+// trustees hold keys.
+func (k *testKeys) encryptionJson(threshold int, trustees ...testIdentity) string {
+	encryption := Encryption{PublicKey: k.publicKey.encode(), Threshold: threshold}
+	for i, trustee := range trustees {
+		encryption.Trustees = append(encryption.Trustees, Trustee{ID: trustee.ID, Index: i + 1, PublicShare: basePoint().mul(k.shares[i]).encode()})
+	}
+	encryptionJson, _ := json.Marshal(encryption)
+	return `"encryption":` + string(encryptionJson)
+}
+
+// encryptedBallot returns a plurality ballot of voter in election for
+// chosen among candidateIDs, encrypted under y with valid proofs.
+func encryptedBallot(t *testing.T, y ecPoint, electionID string, voter testIdentity, candidateIDs []string, chosen string) *Ballot {
+	values := make(map[string]int)
+	randomness := make(map[string]*big.Int)
+	for _, candidateID := range candidateIDs {
+		values[candidateID] = 0
+		randomness[candidateID] = randomScalar(t)
+	}
+	values[chosen] = 1
+	return encryptBallot(t, y, bindLabel(ballotProofLabel, electionID, voter.ID), values, randomness)
+}
+
+// encryptBallot returns a plurality ballot encrypting values by candidate
+// ID under y with randomness, with proofs under label. The proofs only
+// verify if every value is 0 or 1 and they sum up to 1.
+func encryptBallot(t *testing.T, y ecPoint, label string, values map[string]int, randomness map[string]*big.Int) *Ballot {
+	ballot := &Ballot{Encrypted: map[string]Ciphertext{}, Proofs: map[string]DisjunctiveProof{}}
+	sum := ciphertext{identity, identity}
+	sumR := new(big.Int)
+	for candidateID, m := range values {
+		r := randomness[candidateID]
+		c := encrypt(y, m, r)
+		ballot.Encrypted[candidateID] = c.encode()
+		actual := 0
+		if m != 0 {
+			actual = 1
+		}
+		ballot.Proofs[candidateID] = proveOneOf(t, bindLabel(label, candidateID), y, c, r, []int{0, 1}, actual)
+		sum = sum.add(c)
+		sumR.Add(sumR, r)
+	}
+	ballot.SumProof = proveOneOf(t, bindLabel(label, "", "sum"), y, sum, sumR.Mod(sumR, curve.Params().N), []int{1}, 0)
+	return ballot
+}
+
+func ballotJson(t *testing.T, ballot *Ballot) string {
+	data, err := json.Marshal(ballot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// decryptionShare returns the partial decryptions of encrypted with the
+// share x of a trustee, proved under label.
+func decryptionShare(t *testing.T, label func(candidateKey string) string, x *big.Int, encrypted map[string]ciphertext) string {
+	partials := make(map[string]PartialDecryption)
+	for candidateKey, c := range encrypted {
+		partials[candidateKey] = PartialDecryption{D: c.A.mul(x).encode(), Proof: proveEqualLogs(t, label(candidateKey), x, c.A)}
+	}
+	data, err := json.Marshal(partials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestEncryptionIsValidated(t *testing.T) {
+	_, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	keys := newTestKeys(t, 1, 1)
+	encryption := keys.encryptionJson(1, newIdentity(t, "trustee", nil))
+
+	for _, field := range []string{`"privateData":{"collection":"ballots"}`, `"weights":{"source":"table"}`} {
+		response := stub.invoke(admin, "initializationInvokation", "e", testElectionJson(10, encryption+","+field+","+lifecycleTestElection))
+		if response.Status == shim.OK {
+			t.Fatalf("encryption with %s accepted", field)
+		}
+		if fields := violationFields(t, response.Message); strings.Join(fields, ",") != "encryption" {
+			t.Errorf("encryption with %s: violations of %v, expected encryption", field, fields)
+		}
+	}
+}
+
+func TestEncryptedTallyIsDecryptedByTrustees(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	trustees := []testIdentity{newIdentity(t, "trustee1", nil), newIdentity(t, "trustee2", nil), newIdentity(t, "trustee3", nil)}
+	keys := newTestKeys(t, 3, 2)
+	candidateIDs := []string{"a", "b"}
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, keys.encryptionJson(2, trustees...)+
+		`,"candidates":[{"id":"a","name":"A"},{"id":"b","name":"B"}],"endCondition":{"type":"TimeOnlyCondition"}`))
+	for i, chosen := range []string{"a", "b", "a"} {
+		voter := newVoter(t, "voter"+strconv.Itoa(i))
+		stub.mustInvoke(t, voter, "voteInvokation", "e", ballotJson(t, encryptedBallot(t, keys.publicKey, "e", voter, candidateIDs, chosen)))
+	}
+	stub.expectError(t, "Decryption shares can only be submitted while the election is closed", trustees[0], "submitDecryptionShare", "e", "{}")
+	setClock(frozen, testEndDate+1)
+	if tally := queryTally(t, stub, admin, "e"); !tally.Undecrypted || tally.Results[0].Votes != 0 {
+		t.Errorf("tally %+v before the decryption, expected it undecrypted", tally)
+	}
+
+	encrypted, _, err := getEncryptedTally(stub, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound := func(trustee testIdentity) func(string) string {
+		return func(candidateKey string) string {
+			return bindLabel(decryptionLabel, "e", trustee.ID, candidateKey)
+		}
+	}
+	unbound := func(string) string { return decryptionLabel }
+	stub.expectError(t, "User isn't a trustee of the election", admin, "submitDecryptionShare", "e", decryptionShare(t, bound(admin), keys.shares[0], encrypted))
+	// A proof made for another trustee or without context doesn't verify.
+	stub.expectError(t, `Partial decryption for "a"`, trustees[0], "submitDecryptionShare", "e", decryptionShare(t, unbound, keys.shares[0], encrypted))
+	stub.expectError(t, `Partial decryption for "a"`, trustees[0], "submitDecryptionShare", "e", decryptionShare(t, bound(trustees[1]), keys.shares[0], encrypted))
+	stub.expectError(t, `Partial decryption for "a"`, trustees[0], "submitDecryptionShare", "e", decryptionShare(t, bound(trustees[0]), keys.shares[1], encrypted))
+	stub.mustInvoke(t, trustees[0], "submitDecryptionShare", "e", decryptionShare(t, bound(trustees[0]), keys.shares[0], encrypted))
+	stub.expectError(t, "Trustee already submitted a decryption share", trustees[0], "submitDecryptionShare", "e", decryptionShare(t, bound(trustees[0]), keys.shares[0], encrypted))
+	stub.expectError(t, "Only 1 of 2 decryption shares submitted", admin, "decryptTally", "e")
+	stub.mustInvoke(t, trustees[2], "submitDecryptionShare", "e", decryptionShare(t, bound(trustees[2]), keys.shares[2], encrypted))
+
+	stub.expectError(t, "User isn't admin", trustees[0], "decryptTally", "e")
+	stub.mustInvoke(t, admin, "decryptTally", "e")
+	tally := queryTally(t, stub, admin, "e")
+	if tally.Undecrypted || !reflect.DeepEqual(tally.Results, []CandidateResult{{"a", "A", 2}, {"b", "B", 1}}) {
+		t.Errorf("decrypted tally %+v, expected a 2 and b 1", tally)
+	}
+}
+
+func TestEncryptedBallotsNeedValidProofs(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	alice := newVoter(t, "alice")
+	bob := newVoter(t, "bob")
+	keys := newTestKeys(t, 1, 1)
+	candidateIDs := []string{"a", "b"}
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, keys.encryptionJson(1, newIdentity(t, "trustee", nil))+
+		`,"candidates":[{"id":"a","name":"A"},{"id":"b","name":"B"}],"endCondition":{"type":"TimeOnlyCondition"}`))
+	label := bindLabel(ballotProofLabel, "e", alice.ID)
+	randomness := map[string]*big.Int{"a": randomScalar(t), "b": randomScalar(t)}
+	ballots := map[string]*Ballot{
+		"sum proof: proof doesn't verify":               encryptBallot(t, keys.publicKey, label, map[string]int{"a": 1, "b": 1}, randomness),
+		`proof for candidate "a": proof doesn't verify`: encryptBallot(t, keys.publicKey, label, map[string]int{"a": 2, "b": 0}, randomness),
+	}
+	for message, ballot := range ballots {
+		stub.expectError(t, "Invalid ballot: "+message, alice, "voteInvokation", "e", ballotJson(t, ballot))
+	}
+	// Proofs don't verify for another voter or election.
+	for _, ballot := range []*Ballot{encryptedBallot(t, keys.publicKey, "e", bob, candidateIDs, "a"), encryptedBallot(t, keys.publicKey, "other", alice, candidateIDs, "a")} {
+		stub.expectError(t, `Invalid ballot: proof for candidate "a"`, alice, "voteInvokation", "e", ballotJson(t, ballot))
+	}
+
+	valid := encryptBallot(t, keys.publicKey, label, map[string]int{"a": 1, "b": 0}, randomness)
+	stub.mustInvoke(t, alice, "voteInvokation", "e", ballotJson(t, valid))
+	// A ciphertext cast before isn't counted again, even with fresh proofs.
+	reused := encryptBallot(t, keys.publicKey, bindLabel(ballotProofLabel, "e", bob.ID), map[string]int{"a": 1, "b": 0}, randomness)
+	stub.expectError(t, `Ciphertext for candidate "a" was cast before`, bob, "voteInvokation", "e", ballotJson(t, reused))
+
+	// The proofs are stored with the ballot for anyone to verify them again.
+	var stored Ballot
+	err := json.Unmarshal(stub.mustInvoke(t, alice, "ownVoteQuery", "e"), &stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored.Proofs, valid.Proofs) || !reflect.DeepEqual(stored.SumProof, valid.SumProof) {
+		t.Errorf("stored proofs %+v and %+v, expected %+v and %+v", stored.Proofs, stored.SumProof, valid.Proofs, valid.SumProof)
+	}
+	electionData, _, err := getElection(stub, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = verifyEncryptedBallot("e", alice.ID, electionData, &stored)
+	if err != nil {
+		t.Errorf("stored ballot doesn't verify: %v", err)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// Built-in endCondition types.
+const (
+	TimeOnlyCondition            = "TimeOnlyCondition"
+	EndDateCondition             = "EndDateCondition"
+	VoterPercentileCondition     = "VoterPercentileCondition"
+	CandidatePercentileCondition = "CandidatePercentileCondition"
+	VoteCountCondition           = "VoteCountCondition"
+	AllVotersCondition           = "AllVotersCondition"
+	ManualCloseCondition         = "ManualCloseCondition"
+	AndCondition                 = "AndCondition"
+	OrCondition                  = "OrCondition"
+	NotCondition                 = "NotCondition"
+)
+
+// EndCondition decides when an election closes before its endDate. endDate
+// always closes an election, whatever the condition says.
+type EndCondition interface {
+	// reached reports whether the election should close.
+	reached(state *EndConditionState) bool
+	// validate adds a violation for every invalid setting of the condition
+	// to verr. field is the path of the condition in ElectionData.
+	validate(electionData *ElectionData, field string, verr *ValidationError)
+	// dependsOn returns the inputs besides the clock the condition depends
+	// on as a combination of the *Input flags.
+	dependsOn() int
+}
+
+// Inputs of an EndCondition besides the clock.
+const (
+	ballotsInput = 1 << iota
+	manualCloseInput
+)
+
+// EndConditionState is what end conditions are evaluated against.
+type EndConditionState struct {
+	ElectionData         *ElectionData
+	Counters             *Counters
+	Now                  int64
+	ManualCloseRequested bool
+}
+
+// endConditionTypes maps the type of an endCondition JSON object to a
+// constructor of the EndCondition it is decoded into.
+var endConditionTypes = map[string]func() EndCondition{}
+
+// registerEndCondition makes an EndCondition available under conditionType.
+func registerEndCondition(conditionType string, newCondition func() EndCondition) {
+	endConditionTypes[conditionType] = newCondition
+}
+
+func init() {
+	registerEndCondition(TimeOnlyCondition, func() EndCondition { return &timeOnlyCondition{} })
+	registerEndCondition(EndDateCondition, func() EndCondition { return &endDateCondition{} })
+	registerEndCondition(VoterPercentileCondition, func() EndCondition { return &voterPercentileCondition{} })
+	registerEndCondition(CandidatePercentileCondition, func() EndCondition { return &candidatePercentileCondition{} })
+	registerEndCondition(VoteCountCondition, func() EndCondition { return &voteCountCondition{} })
+	registerEndCondition(AllVotersCondition, func() EndCondition { return &allVotersCondition{} })
+	registerEndCondition(ManualCloseCondition, func() EndCondition { return &manualCloseCondition{} })
+	registerEndCondition(AndCondition, func() EndCondition { return &andCondition{} })
+	registerEndCondition(OrCondition, func() EndCondition { return &orCondition{} })
+	registerEndCondition(NotCondition, func() EndCondition { return &notCondition{} })
+}
+
+// AnyEndCondition holds an EndCondition of any registered type and
+// (un)marshals it as a JSON object with a "type" field.
+type AnyEndCondition struct {
+	EndCondition
+}
+
+func (a *AnyEndCondition) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var header struct {
+		Type string `json:"type"`
+	}
+	err := json.Unmarshal(data, &header)
+	if err != nil {
+		return err
+	}
+	newCondition, ok := endConditionTypes[header.Type]
+	if !ok {
+		return errors.New("unknown endCondition type \"" + header.Type + "\"")
+	}
+	condition := newCondition()
+	err = decodeStrict(data, condition)
+	if err != nil {
+		return errors.New(header.Type + ": " + err.Error())
+	}
+	a.EndCondition = condition
+	return nil
+}
+
+func (a AnyEndCondition) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.EndCondition)
+}
+
+// validateEndCondition validates a possibly missing condition.
+func validateEndCondition(condition AnyEndCondition, electionData *ElectionData, field string, verr *ValidationError) {
+	if condition.EndCondition == nil {
+		verr.add(field, "must be set")
+		return
+	}
+	condition.validate(electionData, field, verr)
+}
+
+// Every condition carries its Type so that it round-trips through JSON.
+
+type timeOnlyCondition struct {
+	Type string `json:"type"`
+}
+
+func (c *timeOnlyCondition) reached(state *EndConditionState) bool {
+	return false
+}
+
+func (c *timeOnlyCondition) validate(electionData *ElectionData, field string, verr *ValidationError) {
+}
+
+func (c *timeOnlyCondition) dependsOn() int {
+	return 0
+}
+
+type endDateCondition struct {
+	Type string `json:"type"`
+}
+
+func (c *endDateCondition) reached(state *EndConditionState) bool {
+	return state.Now > state.ElectionData.EndDate
+}
+
+func (c *endDateCondition) validate(electionData *ElectionData, field string, verr *ValidationError) {
+}
+
+func (c *endDateCondition) dependsOn() int {
+	return 0
+}
+
+// Ballots of voterPercentileCondition and voteCountCondition selects which
+// ballots count, see CastBallots, CountedBallots and ValidBallots.
+type voterPercentileCondition struct {
+	Type       string `json:"type"`
+	Percentage int    `json:"percentage"`
+	Ballots    string `json:"ballots,omitempty"`
+}
+
+func (c *voterPercentileCondition) reached(state *EndConditionState) bool {
+	return state.Counters.ballots(c.Ballots)*100/state.ElectionData.VoterCount >= c.Percentage
+}
+
+func (c *voterPercentileCondition) validate(electionData *ElectionData, field string, verr *ValidationError) {
+	validatePercentage(c.Percentage, field, verr)
+	validateBallotKind(c.Ballots, electionData, field, verr)
+}
+
+func (c *voterPercentileCondition) dependsOn() int {
+	return ballotsInput
+}
+
+type candidatePercentileCondition struct {
+	Type       string `json:"type"`
+	Percentage int    `json:"percentage"`
+}
+
+func (c *candidatePercentileCondition) reached(state *EndConditionState) bool {
+	for _, votes := range state.Counters.Candidates {
+		if votes*100/state.ElectionData.VoterCount >= c.Percentage {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *candidatePercentileCondition) validate(electionData *ElectionData, field string, verr *ValidationError) {
+	validatePercentage(c.Percentage, field, verr)
+	if electionData.votesHidden() {
+		verr.add(field+".type", "votes of commit-reveal, encrypted and private elections aren't known before the tally")
+	}
+	for _, contest := range electionData.contests() {
+		if contest.VotingMethod != ReferendumMethod {
+			return
+		}
+	}
+	verr.add(field+".type", "referendums have no candidates")
+}
+
+func (c *candidatePercentileCondition) dependsOn() int {
+	return ballotsInput
+}
+
+func validatePercentage(percentage int, field string, verr *ValidationError) {
+	if percentage < 1 || percentage > 100 {
+		verr.add(field+".percentage", "must be between 1 and 100")
+	}
+}
+
+func validateBallotKind(kind string, electionData *ElectionData, field string, verr *ValidationError) {
+	switch kind {
+	case "", CastBallots, CountedBallots:
+	case ValidBallots:
+		if electionData.CommitReveal != nil {
+			verr.add(field+".ballots", "blank ballots of commit-reveal elections aren't known before the reveal")
+		} else if electionData.PrivateData != nil {
+			verr.add(field+".ballots", "blank ballots of private elections aren't known before the tally")
+		}
+	default:
+		verr.add(field+".ballots", "must be one of cast, counted and valid")
+	}
+}
+
+type voteCountCondition struct {
+	Type    string `json:"type"`
+	Count   int    `json:"count"`
+	Ballots string `json:"ballots,omitempty"`
+}
+
+func (c *voteCountCondition) reached(state *EndConditionState) bool {
+	return state.Counters.ballots(c.Ballots) >= c.Count
+}
+
+func (c *voteCountCondition) validate(electionData *ElectionData, field string, verr *ValidationError) {
+	if c.Count < 1 {
+		verr.add(field+".count", "must be greater than 0")
+	} else if electionData.VoterCount > 0 && c.Count > electionData.VoterCount {
+		verr.add(field+".count", "must not exceed voterCount")
+	}
+	validateBallotKind(c.Ballots, electionData, field, verr)
+}
+
+func (c *voteCountCondition) dependsOn() int {
+	return ballotsInput
+}
+
+type allVotersCondition struct {
+	Type string `json:"type"`
+}
+
+func (c *allVotersCondition) reached(state *EndConditionState) bool {
+	return state.Counters.Ballots >= state.ElectionData.VoterCount
+}
+
+func (c *allVotersCondition) validate(electionData *ElectionData, field string, verr *ValidationError) {
+}
+
+func (c *allVotersCondition) dependsOn() int {
+	return ballotsInput
+}
+
+// manualCloseCondition is reached once an admin called requestManualClose.
+type manualCloseCondition struct {
+	Type string `json:"type"`
+}
+
+func (c *manualCloseCondition) reached(state *EndConditionState) bool {
+	return state.ManualCloseRequested
+}
+
+func (c *manualCloseCondition) validate(electionData *ElectionData, field string, verr *ValidationError) {
+}
+
+func (c *manualCloseCondition) dependsOn() int {
+	return manualCloseInput
+}
+
+type andCondition struct {
+	Type       string            `json:"type"`
+	Conditions []AnyEndCondition `json:"conditions"`
+}
+
+func (c *andCondition) reached(state *EndConditionState) bool {
+	for _, condition := range c.Conditions {
+		if !condition.reached(state) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *andCondition) validate(electionData *ElectionData, field string, verr *ValidationError) {
+	validateConditions(c.Conditions, electionData, field, verr)
+}
+
+func (c *andCondition) dependsOn() int {
+	return conditionsDependOn(c.Conditions)
+}
+
+type orCondition struct {
+	Type       string            `json:"type"`
+	Conditions []AnyEndCondition `json:"conditions"`
+}
+
+func (c *orCondition) reached(state *EndConditionState) bool {
+	for _, condition := range c.Conditions {
+		if condition.reached(state) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *orCondition) validate(electionData *ElectionData, field string, verr *ValidationError) {
+	validateConditions(c.Conditions, electionData, field, verr)
+}
+
+func (c *orCondition) dependsOn() int {
+	return conditionsDependOn(c.Conditions)
+}
+
+func validateConditions(conditions []AnyEndCondition, electionData *ElectionData, field string, verr *ValidationError) {
+	if len(conditions) < 2 {
+		verr.add(field+".conditions", "must contain at least two conditions")
+	}
+	for i, condition := range conditions {
+		validateEndCondition(condition, electionData, field+".conditions["+strconv.Itoa(i)+"]", verr)
+	}
+}
+
+// conditionsDependOn returns the inputs any of conditions depends on.
+// Missing conditions are reported by validate.
+func conditionsDependOn(conditions []AnyEndCondition) int {
+	inputs := 0
+	for _, condition := range conditions {
+		if condition.EndCondition != nil {
+			inputs |= condition.dependsOn()
+		}
+	}
+	return inputs
+}
+
+type notCondition struct {
+	Type      string          `json:"type"`
+	Condition AnyEndCondition `json:"condition"`
+}
+
+func (c *notCondition) reached(state *EndConditionState) bool {
+	return !c.Condition.reached(state)
+}
+
+// validate rejects negating a condition that only depends on the clock. It
+// is never reached before endDate, so its negation would be reached from
+// the start and refuse every ballot, or the other way round.
+func (c *notCondition) validate(electionData *ElectionData, field string, verr *ValidationError) {
+	validateEndCondition(c.Condition, electionData, field+".condition", verr)
+	if c.Condition.EndCondition != nil && c.Condition.dependsOn() == 0 {
+		verr.add(field+".condition", "must depend on ballots or a manual close, negating a time only condition is reached from the start")
+	}
+}
+
+func (c *notCondition) dependsOn() int {
+	if c.Condition.EndCondition == nil {
+		return 0
+	}
+	return c.Condition.dependsOn()
+}
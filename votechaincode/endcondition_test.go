@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestNotConditionsReachedFromTheStartAreRejected(t *testing.T) {
+	_, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+
+	conditions := map[string]string{
+		`{"type":"NotCondition","condition":{"type":"TimeOnlyCondition"}}`:                                                                                "endCondition.condition",
+		`{"type":"NotCondition","condition":{"type":"EndDateCondition"}}`:                                                                                 "endCondition.condition",
+		`{"type":"NotCondition","condition":{"type":"VoteCountCondition","count":3}}`:                                                                     "endCondition",
+		`{"type":"NotCondition","condition":{"type":"ManualCloseCondition"}}`:                                                                             "endCondition",
+		`{"type":"OrCondition","conditions":[{"type":"AllVotersCondition"},{"type":"NotCondition","condition":{"type":"VoteCountCondition","count":3}}]}`: "endCondition",
+		`{"type":"AndCondition","conditions":[{"type":"AllVotersCondition"},{"type":"NotCondition","condition":{"type":"TimeOnlyCondition"}}]}`:           "endCondition.conditions[1].condition",
+	}
+	for condition, field := range conditions {
+		response := stub.invoke(admin, "initializationInvokation", "e", testElectionJson(10, `"candidates":[{"id":"a","name":"A"}],"endCondition":`+condition))
+		if response.Status == shim.OK {
+			t.Fatalf("%s accepted", condition)
+		}
+		if fields := violationFields(t, response.Message); strings.Join(fields, ",") != field {
+			t.Errorf("%s: violations of %v, expected %s", condition, fields, field)
+		}
+	}
+
+	// Negating a manual close is fine while the vote count holds it back.
+	stub.mustInvoke(t, admin, "initializationInvokation", "e", testElectionJson(10, `"candidates":[{"id":"a","name":"A"}],"endCondition":`+
+		`{"type":"AndCondition","conditions":[{"type":"VoteCountCondition","count":3},{"type":"NotCondition","condition":{"type":"ManualCloseCondition"}}]}`))
+}
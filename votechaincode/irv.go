@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// InstantRunoffResult is the elimination transcript of an instant-runoff
+// tally.
+type InstantRunoffResult struct {
+	Rounds []InstantRunoffRound `json:"rounds"`
+	Winner string               `json:"winner,omitempty"`
+}
+
+// InstantRunoffRound is a single counting round. Counts lists the
+// continuing candidates in registry order. Transfers tell where the ballots
+// of the candidate eliminated in this round went for the next round. In
+// weighted elections all numbers of ballots are their weight.
+type InstantRunoffRound struct {
+	Round              int              `json:"round"`
+	Counts             []CandidateCount `json:"counts"`
+	ContinuingBallots  int              `json:"continuingBallots"`
+	ExhaustedBallots   int              `json:"exhaustedBallots"`
+	Elected            string           `json:"elected,omitempty"`
+	Eliminated         string           `json:"eliminated,omitempty"`
+	TieBreak           string           `json:"tieBreak,omitempty"`
+	Transfers          []CandidateCount `json:"transfers,omitempty"`
+	ExhaustedTransfers int              `json:"exhaustedTransfers,omitempty"`
+}
+
+// CandidateCount is a number of ballots attributed to a candidate.
+type CandidateCount struct {
+	CandidateID string `json:"candidateID"`
+	Votes       int    `json:"votes"`
+}
+
+// instantRunoffMethod lets voters rank candidates. The candidate with the
+// fewest votes is eliminated round by round and its ballots transfer to the
+// next continuing preference until a candidate holds a majority of the
+// continuing ballots.
+type instantRunoffMethod struct{}
+
+func (instantRunoffMethod) validateRules(rules *ContestRules, field string, verr *ValidationError) {
+	rejectSelectionLimits(rules, field, verr)
+	rejectSeats(rules, field, verr)
+	rejectWriteIns(rules, field, verr)
+}
+
+func (instantRunoffMethod) validateBallot(rules *ContestRules, ballot *Ballot) error {
+	err := ballot.expectFields("ranking")
+	if err != nil {
+		return err
+	}
+	return validateRanking(rules, ballot.Ranking)
+}
+
+// counters attributes a ranked ballot to its first preference.
+func (instantRunoffMethod) counters(ballot *Ballot) *Counters {
+	counters := newCounters()
+	counters.Ballots = 1
+	counters.Candidates[ballot.Ranking[0]] = 1
+	return counters
+}
+
+// tally reports the first preferences as Results and the runoff winner as
+// the only winner.
+func (instantRunoffMethod) tally(electionData *ElectionData, rules *ContestRules, ballots []*Ballot, tally *ContestTally) {
+	for _, ballot := range ballots {
+		tally.Results[rules.candidateIndex(ballot.Ranking[0])].Votes += ballot.weight()
+	}
+	result := runInstantRunoff(rules, ballots)
+	tally.InstantRunoff = result
+	if result.Winner != "" {
+		tally.Winners = []string{result.Winner}
+	}
+}
+
+// runInstantRunoff computes the IRV rounds of the given ranked ballots.
+func runInstantRunoff(rules *ContestRules, ballots []*Ballot) *InstantRunoffResult {
+	result := &InstantRunoffResult{Rounds: []InstantRunoffRound{}}
+	continuing := make(map[string]bool)
+	for _, candidate := range rules.Candidates {
+		continuing[candidate.ID] = true
+	}
+
+	// holders[i] is the candidate ballots[i] currently counts for, "" once
+	// the ballot is exhausted.
+	holders := make([]string, len(ballots))
+	for i, ballot := range ballots {
+		holders[i] = nextPreference(ballot.Ranking, continuing)
+	}
+
+	var history []map[string]int
+	for len(continuing) > 0 {
+		counts := make(map[string]int)
+		round := InstantRunoffRound{Round: len(result.Rounds) + 1, Counts: []CandidateCount{}}
+		for i, holder := range holders {
+			if holder == "" {
+				round.ExhaustedBallots += ballots[i].weight()
+				continue
+			}
+			counts[holder] += ballots[i].weight()
+			round.ContinuingBallots += ballots[i].weight()
+		}
+		for _, candidate := range rules.Candidates {
+			if continuing[candidate.ID] {
+				round.Counts = append(round.Counts, CandidateCount{CandidateID: candidate.ID, Votes: counts[candidate.ID]})
+			}
+		}
+		history = append(history, counts)
+
+		if round.ContinuingBallots == 0 {
+			result.Rounds = append(result.Rounds, round)
+			break
+		}
+		leader := round.Counts[0]
+		for _, count := range round.Counts {
+			if count.Votes > leader.Votes {
+				leader = count
+			}
+		}
+		if leader.Votes*2 > round.ContinuingBallots {
+			round.Elected = leader.CandidateID
+			result.Winner = leader.CandidateID
+			result.Rounds = append(result.Rounds, round)
+			break
+		}
+
+		round.Eliminated, round.TieBreak = lowestCandidate(round.Counts, history, "round")
+		delete(continuing, round.Eliminated)
+		transfers := make(map[string]int)
+		for i, ballot := range ballots {
+			if holders[i] != round.Eliminated {
+				continue
+			}
+			holders[i] = nextPreference(ballot.Ranking, continuing)
+			if holders[i] == "" {
+				round.ExhaustedTransfers += ballot.weight()
+			} else {
+				transfers[holders[i]] += ballot.weight()
+			}
+		}
+		for _, candidate := range rules.Candidates {
+			if transfers[candidate.ID] > 0 {
+				round.Transfers = append(round.Transfers, CandidateCount{CandidateID: candidate.ID, Votes: transfers[candidate.ID]})
+			}
+		}
+		result.Rounds = append(result.Rounds, round)
+	}
+	return result
+}
+
+// nextPreference returns the highest ranked continuing candidate or "" if
+// the ranking is exhausted.
+func nextPreference(ranking []string, continuing map[string]bool) string {
+	for _, candidateID := range ranking {
+		if continuing[candidateID] {
+			return candidateID
+		}
+	}
+	return ""
+}
+
+// lowestCandidate picks the candidate to eliminate from counts, which are in
+// registry order. Ties are broken by the counts of earlier rounds, latest
+// round first, and if the candidates were tied in every round the one listed
+// last in the registry is eliminated. step names a round in the returned
+// description, which is empty if there was no tie.
+func lowestCandidate(counts []CandidateCount, history []map[string]int, step string) (string, string) {
+	lowest := counts[0].Votes
+	for _, count := range counts {
+		if count.Votes < lowest {
+			lowest = count.Votes
+		}
+	}
+	var tied []string
+	for _, count := range counts {
+		if count.Votes == lowest {
+			tied = append(tied, count.CandidateID)
+		}
+	}
+	if len(tied) == 1 {
+		return tied[0], ""
+	}
+
+	for round := len(history) - 2; round >= 0; round-- {
+		fewest := history[round][tied[0]]
+		for _, candidateID := range tied {
+			if history[round][candidateID] < fewest {
+				fewest = history[round][candidateID]
+			}
+		}
+		var stillTied []string
+		for _, candidateID := range tied {
+			if history[round][candidateID] == fewest {
+				stillTied = append(stillTied, candidateID)
+			}
+		}
+		if len(stillTied) == 1 {
+			return stillTied[0], "fewest votes in " + step + " " + strconv.Itoa(round+1)
+		}
+		tied = stillTied
+	}
+	return tied[len(tied)-1], "listed last in the candidate registry"
+}
+
+// Query the round by round transcript of an instant-runoff contest.
+func (t *VoteChaincode) instantRunoffQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	tally, err := getContestTally(stub, args, InstantRunoffMethod)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	resultJson, err := json.Marshal(tally.InstantRunoff)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	return shim.Success(resultJson)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testRules returns the rules of a contest with the given candidate IDs.
+func testRules(candidateIDs ...string) *ContestRules {
+	rules := &ContestRules{}
+	for _, candidateID := range candidateIDs {
+		rules.Candidates = append(rules.Candidates, Candidate{ID: candidateID, Name: strings.ToUpper(candidateID)})
+	}
+	return rules
+}
+
+// rankedBallots returns count ballots with the given ranking.
+func rankedBallots(count int, ranking ...string) []*Ballot {
+	ballots := make([]*Ballot, count)
+	for i := range ballots {
+		ballots[i] = &Ballot{Ranking: ranking}
+	}
+	return ballots
+}
+
+// The Tennessee capital example of the Wikipedia article on instant-runoff
+// voting: Knoxville wins in the third round although Memphis leads the
+// first preferences.
+func TestInstantRunoffTennessee(t *testing.T) {
+	rules := testRules("memphis", "nashville", "chattanooga", "knoxville")
+	var ballots []*Ballot
+	ballots = append(ballots, rankedBallots(42, "memphis", "nashville", "chattanooga", "knoxville")...)
+	ballots = append(ballots, rankedBallots(26, "nashville", "chattanooga", "knoxville", "memphis")...)
+	ballots = append(ballots, rankedBallots(15, "chattanooga", "knoxville", "nashville", "memphis")...)
+	ballots = append(ballots, rankedBallots(17, "knoxville", "chattanooga", "nashville", "memphis")...)
+
+	result := runInstantRunoff(rules, ballots)
+
+	rounds := []struct {
+		counts     []CandidateCount
+		eliminated string
+		elected    string
+	}{
+		{
+			counts:     []CandidateCount{{"memphis", 42}, {"nashville", 26}, {"chattanooga", 15}, {"knoxville", 17}},
+			eliminated: "chattanooga",
+		},
+		{
+			counts:     []CandidateCount{{"memphis", 42}, {"nashville", 26}, {"knoxville", 32}},
+			eliminated: "nashville",
+		},
+		{
+			counts:  []CandidateCount{{"memphis", 42}, {"knoxville", 58}},
+			elected: "knoxville",
+		},
+	}
+	if len(result.Rounds) != len(rounds) {
+		t.Fatalf("%d rounds, expected %d", len(result.Rounds), len(rounds))
+	}
+	for i, expected := range rounds {
+		round := result.Rounds[i]
+		if !reflect.DeepEqual(round.Counts, expected.counts) {
+			t.Errorf("round %d: counts %v, expected %v", i+1, round.Counts, expected.counts)
+		}
+		if round.Eliminated != expected.eliminated || round.Elected != expected.elected {
+			t.Errorf("round %d: eliminated %q and elected %q, expected %q and %q", i+1, round.Eliminated, round.Elected, expected.eliminated, expected.elected)
+		}
+		if round.ContinuingBallots != 100 || round.ExhaustedBallots != 0 {
+			t.Errorf("round %d: %d continuing and %d exhausted ballots", i+1, round.ContinuingBallots, round.ExhaustedBallots)
+		}
+	}
+	if result.Winner != "knoxville" {
+		t.Errorf("winner %q, expected knoxville", result.Winner)
+	}
+}
+
+func TestInstantRunoffExhaustedBallots(t *testing.T) {
+	rules := testRules("a", "b", "c")
+	var ballots []*Ballot
+	ballots = append(ballots, rankedBallots(4, "a")...)
+	ballots = append(ballots, rankedBallots(3, "b")...)
+	ballots = append(ballots, rankedBallots(2, "c")...)
+
+	result := runInstantRunoff(rules, ballots)
+
+	if len(result.Rounds) != 2 {
+		t.Fatalf("%d rounds, expected 2", len(result.Rounds))
+	}
+	if result.Rounds[0].Eliminated != "c" || result.Rounds[0].ExhaustedTransfers != 2 {
+		t.Errorf("unexpected first round %+v", result.Rounds[0])
+	}
+	// 4 of the 7 continuing ballots are a majority.
+	if result.Rounds[1].ExhaustedBallots != 2 || result.Winner != "a" {
+		t.Errorf("unexpected second round %+v", result.Rounds[1])
+	}
+}
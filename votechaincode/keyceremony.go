@@ -0,0 +1,699 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// The key ceremony is Pedersen's distributed key generation with Feldman
+// commitments. Every trustee deals a random polynomial of degree
+// threshold-1, the joint private key is the sum of their constant terms and
+// is never known to anyone. It runs while the election is a draft:
+//
+//  1. registerTrustee: every trustee registers a key E = xG that shares are
+//     encrypted to.
+//  2. publishCommitments: every trustee commits to their polynomial and
+//     proves they know its constant term, so that no trustee can pick their
+//     part of the key depending on the others'.
+//  3. dealShares: once every trustee committed, every trustee sends every
+//     other trustee their share, encrypted under the trustee's registered
+//     key.
+//  4. fileComplaint: a trustee whose share doesn't match the commitments of
+//     its dealer proves so and the dealer is disqualified.
+//  5. finishKeyCeremony: once the complaint period of every dealing passed,
+//     an admin derives the joint public key and public shares from the
+//     dealings of the qualified trustees.
+const (
+	registrationObjectType = "dkgtrustee"
+	dealingObjectType      = "dkgdealing"
+	complaintObjectType    = "dkgcomplaint"
+)
+
+// Fiat–Shamir and key derivation domains of the key ceremony.
+const (
+	commitmentLabel      = "vote/dkg-commitment"
+	shareEncryptionLabel = "vote/dkg-share"
+	complaintLabel       = "vote/dkg-complaint"
+)
+
+// TrusteeRegistration is the key a trustee receives their shares under.
+type TrusteeRegistration struct {
+	TrusteeID     string `json:"trusteeID"`
+	EncryptionKey string `json:"encryptionKey"`
+	RegisteredAt  int64  `json:"registeredAt"`
+	TxID          string `json:"txID"`
+}
+
+// EncryptedShare is the share s = f(j) of a dealer for the trustee with
+// index j and encryption key E. The dealer picks a random r and sends
+// R = rG and Share = s + hashToScalar(shareEncryptionLabel, R, rE). The
+// trustee recovers s with rE = xR.
+type EncryptedShare struct {
+	R     string `json:"r"`
+	Share string `json:"share"`
+}
+
+// Dealing is the contribution of a trustee to the key. Commitments are
+// a_kG for the coefficients a_k of the trustee's polynomial, the first one
+// is the trustee's part of the public key. ConstantProof proves knowledge
+// of a_0 under the commitmentLabel bound to the election and dealer ID.
+// Shares are keyed by trustee ID and left out for the dealer.
+type Dealing struct {
+	DealerID      string                    `json:"dealerID"`
+	Commitments   []string                  `json:"commitments"`
+	ConstantProof SchnorrProof              `json:"constantProof"`
+	CommittedAt   int64                     `json:"committedAt"`
+	CommitTxID    string                    `json:"commitTxID"`
+	Shares        map[string]EncryptedShare `json:"shares,omitempty"`
+	DealtAt       int64                     `json:"dealtAt,omitempty"`
+	DealTxID      string                    `json:"dealTxID,omitempty"`
+	Disqualified  bool                      `json:"disqualified,omitempty"`
+}
+
+// Complaint is an upheld complaint of a trustee about the share a dealer
+// sent them. SharedKey is xR for the R of the share, proven with the
+// trustee's registered key under the complaintLabel bound to the election,
+// dealer and trustee IDs, so anyone can decrypt the share and see that it
+// doesn't match the dealer's commitments.
+type Complaint struct {
+	DealerID  string             `json:"dealerID"`
+	TrusteeID string             `json:"trusteeID"`
+	SharedKey string             `json:"sharedKey"`
+	Proof     ChaumPedersenProof `json:"proof"`
+	FiledAt   int64              `json:"filedAt"`
+	TxID      string             `json:"txID"`
+}
+
+// KeyCeremonyTranscript is everything the trustees submitted during the key
+// ceremony of an election.
+type KeyCeremonyTranscript struct {
+	Registrations []TrusteeRegistration `json:"registrations"`
+	Dealings      []Dealing             `json:"dealings"`
+	Complaints    []Complaint           `json:"complaints"`
+}
+
+// keyCeremonyPending reports whether the keys of the election are still to
+// be generated by the key ceremony.
+func (e *Encryption) keyCeremonyPending() bool {
+	return e.KeyCeremony && e.PublicKey == ""
+}
+
+// assertKeyCeremonyFinished returns an error if an election still waits
+// for its key.
+func assertKeyCeremonyFinished(electionData *ElectionData) error {
+	if electionData.Encryption != nil && electionData.Encryption.keyCeremonyPending() {
+		return errors.New("Key ceremony hasn't finished yet")
+	}
+	return nil
+}
+
+// feldmanShare returns f(index)G for the polynomial f committed to by
+// commitments.
+func feldmanShare(commitments []ecPoint, index int) ecPoint {
+	result := identity
+	power := big.NewInt(1)
+	for _, commitment := range commitments {
+		result = result.add(commitment.mul(power))
+		power = new(big.Int).Mul(power, big.NewInt(int64(index)))
+	}
+	return result
+}
+
+func decodePoints(encoded []string) ([]ecPoint, error) {
+	points := make([]ecPoint, len(encoded))
+	for i, point := range encoded {
+		var err error
+		points[i], err = decodePoint(point)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+// getCeremonyElection loads an election whose key ceremony is running and
+// the trustee calling.
+func getCeremonyElection(stub shim.ChaincodeStubInterface, electionID string) (*ElectionData, *Trustee, error) {
+	electionData, lifecycle, err := getElection(stub, electionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if electionData.Encryption == nil || !electionData.Encryption.KeyCeremony {
+		return nil, nil, errors.New("Election has no key ceremony")
+	}
+	if !electionData.Encryption.keyCeremonyPending() {
+		return nil, nil, errors.New("Key ceremony already finished")
+	}
+	if lifecycle.State != StateDraft {
+		return nil, nil, errors.New("Key ceremony only runs while the election is a draft")
+	}
+	trusteeID, err := cid.GetID(stub)
+	if err != nil {
+		return nil, nil, errors.New("Couldn't read ID from stub.")
+	}
+	trustee := electionData.Encryption.trustee(trusteeID)
+	if trustee == nil {
+		return nil, nil, errors.New("User isn't a trustee of the election")
+	}
+	return electionData, trustee, nil
+}
+
+// getRegistration returns the registration of a trustee or nil.
+func getRegistration(stub shim.ChaincodeStubInterface, electionID, trusteeID string) (*TrusteeRegistration, error) {
+	key, err := stub.CreateCompositeKey(registrationObjectType, []string{electionID, trusteeID})
+	if err != nil {
+		return nil, err
+	}
+	stateBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get state")
+	}
+	if stateBytes == nil {
+		return nil, nil
+	}
+	var registration TrusteeRegistration
+	err = json.Unmarshal(stateBytes, &registration)
+	if err != nil {
+		return nil, errors.New("Stored registration couldn't be parsed")
+	}
+	return &registration, nil
+}
+
+// getDealing returns the dealing of a trustee or nil.
+func getDealing(stub shim.ChaincodeStubInterface, electionID, dealerID string) (*Dealing, error) {
+	key, err := stub.CreateCompositeKey(dealingObjectType, []string{electionID, dealerID})
+	if err != nil {
+		return nil, err
+	}
+	stateBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get state")
+	}
+	if stateBytes == nil {
+		return nil, nil
+	}
+	var dealing Dealing
+	err = json.Unmarshal(stateBytes, &dealing)
+	if err != nil {
+		return nil, errors.New("Stored dealing couldn't be parsed")
+	}
+	return &dealing, nil
+}
+
+func putDealing(stub shim.ChaincodeStubInterface, electionID string, dealing *Dealing) error {
+	key, err := stub.CreateCompositeKey(dealingObjectType, []string{electionID, dealing.DealerID})
+	if err != nil {
+		return err
+	}
+	dealingJson, err := json.Marshal(dealing)
+	if err != nil {
+		return errors.New("Failed to generate Json")
+	}
+	return stub.PutState(key, dealingJson)
+}
+
+// getKeyCeremony returns the transcript of the key ceremony of an election
+// and the keys its records are stored under. Dealings are marked
+// Disqualified if a complaint about them was upheld.
+func getKeyCeremony(stub shim.ChaincodeStubInterface, electionID string) (*KeyCeremonyTranscript, []string, error) {
+	transcript := &KeyCeremonyTranscript{
+		Registrations: []TrusteeRegistration{},
+		Dealings:      []Dealing{},
+		Complaints:    []Complaint{},
+	}
+	var keys []string
+	for _, objectType := range []string{registrationObjectType, dealingObjectType, complaintObjectType} {
+		stateIterator, err := stub.GetStateByPartialCompositeKey(objectType, []string{electionID})
+		if err != nil {
+			return nil, nil, errors.New("Failed to get StateIterator")
+		}
+		for stateIterator.HasNext() {
+			queryResponse, err := stateIterator.Next()
+			if err != nil {
+				stateIterator.Close()
+				return nil, nil, errors.New("StateIterator failed to retrieve next Element")
+			}
+			switch objectType {
+			case registrationObjectType:
+				var registration TrusteeRegistration
+				err = json.Unmarshal(queryResponse.Value, &registration)
+				transcript.Registrations = append(transcript.Registrations, registration)
+			case dealingObjectType:
+				var dealing Dealing
+				err = json.Unmarshal(queryResponse.Value, &dealing)
+				transcript.Dealings = append(transcript.Dealings, dealing)
+			default:
+				var complaint Complaint
+				err = json.Unmarshal(queryResponse.Value, &complaint)
+				transcript.Complaints = append(transcript.Complaints, complaint)
+			}
+			if err != nil {
+				stateIterator.Close()
+				return nil, nil, errors.New("Stored key ceremony couldn't be parsed")
+			}
+			keys = append(keys, queryResponse.Key)
+		}
+		stateIterator.Close()
+	}
+
+	disqualified := make(map[string]bool)
+	for _, complaint := range transcript.Complaints {
+		disqualified[complaint.DealerID] = true
+	}
+	for i := range transcript.Dealings {
+		transcript.Dealings[i].Disqualified = disqualified[transcript.Dealings[i].DealerID]
+	}
+	return transcript, keys, nil
+}
+
+// deleteKeyCeremony removes the key ceremony records of an election.
+func deleteKeyCeremony(stub shim.ChaincodeStubInterface, electionID string) error {
+	_, keys, err := getKeyCeremony(stub, electionID)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = stub.DelState(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Register the calling trustee for the key ceremony of an election. Expects
+// the election ID and the encoded point E = xG the trustee wants to receive
+// shares under.
+func (t *VoteChaincode) registerTrustee(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID and the encryption key")
+	}
+	electionID := args[0]
+	_, trustee, err := getCeremonyElection(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	encryptionKey, err := decodePoint(args[1])
+	if err != nil {
+		return shim.Error("Encryption key: " + err.Error())
+	}
+	if encryptionKey.isIdentity() {
+		return shim.Error("Encryption key must not be the point at infinity")
+	}
+	registration, err := getRegistration(stub, electionID, trustee.ID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if registration != nil {
+		return shim.Error("Trustee already registered")
+	}
+
+	registration = &TrusteeRegistration{
+		TrusteeID:     trustee.ID,
+		EncryptionKey: args[1],
+		TxID:          stub.GetTxID(),
+	}
+	registration.RegisteredAt, err = nowUnix(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	registrationJson, err := json.Marshal(registration)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	key, err := stub.CreateCompositeKey(registrationObjectType, []string{electionID, trustee.ID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(key, registrationJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("Trustee " + trustee.ID + " registered for election " + electionID)
+	return shim.Success(nil)
+}
+
+// Publish the Feldman commitments of the calling trustee. Expects the
+// election ID, a JSON array of threshold encoded points, the commitment to
+// the constant term first, and a JSON SchnorrProof of the constant term.
+func (t *VoteChaincode) publishCommitments(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID, a JSON array of commitments and a JSON string representing the proof")
+	}
+	electionID := args[0]
+	electionData, trustee, err := getCeremonyElection(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	registration, err := getRegistration(stub, electionID, trustee.ID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if registration == nil {
+		return shim.Error("Trustee isn't registered")
+	}
+	dealing, err := getDealing(stub, electionID, trustee.ID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if dealing != nil {
+		return shim.Error("Trustee already published commitments")
+	}
+
+	dealing = &Dealing{DealerID: trustee.ID, CommitTxID: stub.GetTxID()}
+	err = decodeStrict([]byte(args[1]), &dealing.Commitments)
+	if err != nil {
+		return shim.Error("Commitments couldn't be parsed: " + err.Error())
+	}
+	threshold := electionData.Encryption.Threshold
+	if len(dealing.Commitments) != threshold {
+		return shim.Error("Expecting " + strconv.Itoa(threshold) + " commitments")
+	}
+	commitments, err := decodePoints(dealing.Commitments)
+	if err != nil {
+		return shim.Error("Commitments: " + err.Error())
+	}
+	if commitments[0].isIdentity() {
+		return shim.Error("Commitment to the constant term must not be the point at infinity")
+	}
+	err = decodeStrict([]byte(args[2]), &dealing.ConstantProof)
+	if err != nil {
+		return shim.Error("Proof couldn't be parsed: " + err.Error())
+	}
+	err = dealing.ConstantProof.verify(bindLabel(commitmentLabel, electionID, trustee.ID), commitments[0])
+	if err != nil {
+		return shim.Error("Constant term: " + err.Error())
+	}
+	dealing.CommittedAt, err = nowUnix(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putDealing(stub, electionID, dealing)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("Trustee " + trustee.ID + " published commitments for election " + electionID)
+	return shim.Success(nil)
+}
+
+// Deal the shares of the calling trustee. Expects the election ID and a
+// JSON object mapping the ID of every other trustee to an EncryptedShare.
+// Only accepted once every trustee published their commitments, so that no
+// commitment is chosen after seeing shares.
+func (t *VoteChaincode) dealShares(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID and a JSON string representing the encrypted shares")
+	}
+	electionID := args[0]
+	electionData, trustee, err := getCeremonyElection(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	dealing, err := getDealing(stub, electionID, trustee.ID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if dealing == nil {
+		return shim.Error("Trustee hasn't published commitments yet")
+	}
+	if dealing.Shares != nil {
+		return shim.Error("Trustee already dealt shares")
+	}
+
+	var shares map[string]EncryptedShare
+	err = decodeStrict([]byte(args[1]), &shares)
+	if err != nil {
+		return shim.Error("Shares couldn't be parsed: " + err.Error())
+	}
+	trustees := electionData.Encryption.Trustees
+	if len(shares) != len(trustees)-1 {
+		return shim.Error("Expecting a share for every other trustee")
+	}
+	for _, recipient := range trustees {
+		if recipient.ID == trustee.ID {
+			continue
+		}
+		recipientDealing, err := getDealing(stub, electionID, recipient.ID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if recipientDealing == nil {
+			return shim.Error("Trustee " + recipient.ID + " hasn't published commitments yet")
+		}
+		share, ok := shares[recipient.ID]
+		if !ok {
+			return shim.Error("No share for trustee " + recipient.ID)
+		}
+		r, err := decodePoint(share.R)
+		if err != nil {
+			return shim.Error("Share for trustee " + recipient.ID + ": " + err.Error())
+		}
+		if r.isIdentity() {
+			return shim.Error("Share for trustee " + recipient.ID + ": R must not be the point at infinity")
+		}
+		_, err = decodeScalar(share.Share)
+		if err != nil {
+			return shim.Error("Share for trustee " + recipient.ID + ": " + err.Error())
+		}
+	}
+
+	dealing.Shares = shares
+	dealing.DealTxID = stub.GetTxID()
+	dealing.DealtAt, err = nowUnix(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putDealing(stub, electionID, dealing)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("Trustee " + trustee.ID + " dealt shares for election " + electionID)
+	return shim.Success(nil)
+}
+
+// File a complaint about the share a dealer sent the calling trustee.
+// Expects the election ID, the dealer ID, the shared key xR of the share and
+// a JSON ChaumPedersenProof that log_G(E) equals log_R(xR) for the
+// trustee's encryption key E, under the complaintLabel bound to the
+// election, dealer and trustee IDs. The complaint is only accepted within
+// the complaint period of the dealing and if the decrypted share doesn't
+// match the dealer's commitments, and disqualifies the dealer.
+func (t *VoteChaincode) fileComplaint(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID, the dealer ID, the shared key and a JSON string representing the proof")
+	}
+	electionID, dealerID := args[0], args[1]
+	electionData, trustee, err := getCeremonyElection(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if dealerID == trustee.ID {
+		return shim.Error("Trustees can't complain about their own dealing")
+	}
+	key, err := stub.CreateCompositeKey(complaintObjectType, []string{electionID, dealerID, trustee.ID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stateBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error("Failed to get state")
+	}
+	if stateBytes != nil {
+		return shim.Error("Trustee already complained about this dealer")
+	}
+	dealing, err := getDealing(stub, electionID, dealerID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if dealing == nil || dealing.Shares == nil {
+		return shim.Error("Dealer hasn't dealt shares yet")
+	}
+	// finishKeyCeremony may count the dealing from the deadline on.
+	now, err := nowUnix(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	complaintDeadline := dealing.DealtAt + electionData.Encryption.ComplaintPeriod
+	if now >= complaintDeadline {
+		return shim.Error("Complaints about the shares of " + dealerID + " were accepted until " + strconv.FormatInt(complaintDeadline, 10))
+	}
+	registration, err := getRegistration(stub, electionID, trustee.ID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if registration == nil {
+		return shim.Error("Trustee isn't registered")
+	}
+
+	complaint := Complaint{DealerID: dealerID, TrusteeID: trustee.ID, SharedKey: args[2], TxID: stub.GetTxID()}
+	err = decodeStrict([]byte(args[3]), &complaint.Proof)
+	if err != nil {
+		return shim.Error("Proof couldn't be parsed: " + err.Error())
+	}
+	sharedKey, err := decodePoint(complaint.SharedKey)
+	if err != nil {
+		return shim.Error("Shared key: " + err.Error())
+	}
+	// Stored values were checked by dealShares and publishCommitments.
+	encryptionKey, _ := decodePoint(registration.EncryptionKey)
+	share := dealing.Shares[trustee.ID]
+	r, _ := decodePoint(share.R)
+	encrypted, _ := decodeScalar(share.Share)
+	commitments, err := decodePoints(dealing.Commitments)
+	if err != nil {
+		return shim.Error("Stored dealing couldn't be parsed")
+	}
+	err = complaint.Proof.verify(bindLabel(complaintLabel, electionID, dealerID, trustee.ID), encryptionKey, r, sharedKey)
+	if err != nil {
+		return shim.Error("Shared key: " + err.Error())
+	}
+	value := new(big.Int).Sub(encrypted, hashToScalar(shareEncryptionLabel, r, sharedKey))
+	if basePoint().mul(value).equal(feldmanShare(commitments, trustee.Index)) {
+		return shim.Error("Share matches the commitments of the dealer")
+	}
+
+	complaint.FiledAt = now
+	complaintJson, err := json.Marshal(complaint)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	err = stub.PutState(key, complaintJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.SetEvent("DealerDisqualified", complaintJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("Trustee " + dealerID + " disqualified from the key ceremony of election " + electionID)
+	return shim.Success(complaintJson)
+}
+
+// Finish the key ceremony of an election. Expects the election ID. Every
+// trustee must have registered and the complaint period of every dealing
+// must have passed. The key is made up of the dealings of the trustees that
+// dealt all their shares and weren't disqualified, of which there must be
+// at least threshold. Stores and returns the Encryption of
+// the election with the public key and shares filled in.
+func (t *VoteChaincode) finishKeyCeremony(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err := cid.AssertAttributeValue(stub, "admin", "true")
+	if err != nil {
+		return shim.Error("User isn't admin")
+	}
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID")
+	}
+	electionID := args[0]
+	electionData, lifecycle, err := getElection(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	encryption := electionData.Encryption
+	if encryption == nil || !encryption.KeyCeremony {
+		return shim.Error("Election has no key ceremony")
+	}
+	if !encryption.keyCeremonyPending() {
+		return shim.Error("Key ceremony already finished")
+	}
+	if lifecycle.State != StateDraft {
+		return shim.Error("Key ceremony only runs while the election is a draft")
+	}
+
+	transcript, _, err := getKeyCeremony(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(transcript.Registrations) != len(encryption.Trustees) {
+		return shim.Error("Only " + strconv.Itoa(len(transcript.Registrations)) + " of " + strconv.Itoa(len(encryption.Trustees)) + " trustees registered")
+	}
+	now, err := nowUnix(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var dealers []string
+	var dealings [][]ecPoint
+	for _, dealing := range transcript.Dealings {
+		if dealing.Shares == nil || dealing.Disqualified {
+			continue
+		}
+		complaintDeadline := dealing.DealtAt + encryption.ComplaintPeriod
+		if now < complaintDeadline {
+			return shim.Error("Complaints about the shares of " + dealing.DealerID + " are accepted until " + strconv.FormatInt(complaintDeadline, 10))
+		}
+		commitments, err := decodePoints(dealing.Commitments)
+		if err != nil {
+			return shim.Error("Stored dealing couldn't be parsed")
+		}
+		dealers = append(dealers, dealing.DealerID)
+		dealings = append(dealings, commitments)
+	}
+	// With fewer dealers than threshold, that many trustees together could
+	// know the private key.
+	if len(dealers) < encryption.Threshold {
+		return shim.Error("Only " + strconv.Itoa(len(dealers)) + " of " + strconv.Itoa(encryption.Threshold) + " qualified dealers")
+	}
+
+	// The joint polynomial is the sum of the qualified dealers' ones.
+	publicKey := identity
+	for _, commitments := range dealings {
+		publicKey = publicKey.add(commitments[0])
+	}
+	encryption.PublicKey = publicKey.encode()
+	for i := range encryption.Trustees {
+		publicShare := identity
+		for _, commitments := range dealings {
+			publicShare = publicShare.add(feldmanShare(commitments, encryption.Trustees[i].Index))
+		}
+		encryption.Trustees[i].PublicShare = publicShare.encode()
+	}
+	encryption.Dealers = dealers
+	verr := electionData.validate()
+	if verr != nil {
+		return shim.Error(verr.Error())
+	}
+	err = putElectionData(stub, electionID, electionData)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	encryptionJson, err := json.Marshal(encryption)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	err = stub.SetEvent("KeyCeremonyFinished", encryptionJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("Key ceremony of election " + electionID + " finished")
+	return shim.Success(encryptionJson)
+}
+
+// Query the transcript of the key ceremony of an election.
+func (t *VoteChaincode) keyCeremonyQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID")
+	}
+	electionData, _, err := getElection(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if electionData.Encryption == nil || !electionData.Encryption.KeyCeremony {
+		return shim.Error("Election has no key ceremony")
+	}
+	transcript, _, err := getKeyCeremony(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	transcriptJson, err := json.Marshal(transcript)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	return shim.Success(transcriptJson)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// ceremonyTrustee is a trustee taking part in a key ceremony with the
+// registered key xG and the polynomial it deals.
+type ceremonyTrustee struct {
+	testIdentity
+	index        int
+	x            *big.Int
+	coefficients []*big.Int
+}
+
+func newCeremonyTrustees(t *testing.T, n, threshold int) []*ceremonyTrustee {
+	trustees := make([]*ceremonyTrustee, n)
+	for i := range trustees {
+		trustee := &ceremonyTrustee{testIdentity: newIdentity(t, "trustee"+strconv.Itoa(i+1), nil), index: i + 1, x: randomScalar(t)}
+		for k := 0; k < threshold; k++ {
+			trustee.coefficients = append(trustee.coefficients, randomScalar(t))
+		}
+		trustees[i] = trustee
+	}
+	return trustees
+}
+
+// keyCeremonyJson returns the encryption field of an election whose
+// trustees generate the key in a ceremony.
+func keyCeremonyJson(threshold int, complaintPeriod int64, trustees []*ceremonyTrustee) string {
+	encryption := Encryption{Threshold: threshold, KeyCeremony: true, ComplaintPeriod: complaintPeriod}
+	for _, trustee := range trustees {
+		encryption.Trustees = append(encryption.Trustees, Trustee{ID: trustee.ID, Index: trustee.index})
+	}
+	encryptionJson, _ := json.Marshal(encryption)
+	return `"encryption":` + string(encryptionJson)
+}
+
+// commitments returns the JSON commitments of the trustee's polynomial and
+// the proof of its constant term under label.
+func (c *ceremonyTrustee) commitments(t *testing.T, label string) (string, string) {
+	g := basePoint()
+	var commitments []string
+	for _, coefficient := range c.coefficients {
+		commitments = append(commitments, g.mul(coefficient).encode())
+	}
+	w := randomScalar(t)
+	h := g.mul(c.coefficients[0])
+	challenge := hashToScalar(label, g, h, g.mul(w))
+	z := new(big.Int).Add(w, new(big.Int).Mul(challenge, c.coefficients[0]))
+	proof := SchnorrProof{Challenge: encodeScalar(challenge), Response: encodeScalar(z.Mod(z, curve.Params().N))}
+	commitmentsJson, _ := json.Marshal(commitments)
+	proofJson, _ := json.Marshal(proof)
+	return string(commitmentsJson), string(proofJson)
+}
+
+// shares returns the JSON shares the trustee deals to recipients, with
+// offset added to the share of cheated.
+func (c *ceremonyTrustee) shares(t *testing.T, recipients []*ceremonyTrustee, cheated *ceremonyTrustee, offset int64) string {
+	shares := make(map[string]EncryptedShare)
+	for _, recipient := range recipients {
+		if recipient == c {
+			continue
+		}
+		value := evaluatePolynomial(c.coefficients, recipient.index)
+		if recipient == cheated {
+			value.Add(value, big.NewInt(offset))
+		}
+		r := randomScalar(t)
+		rG := basePoint().mul(r)
+		value.Add(value, hashToScalar(shareEncryptionLabel, rG, basePoint().mul(recipient.x).mul(r)))
+		shares[recipient.ID] = EncryptedShare{R: rG.encode(), Share: encodeScalar(value.Mod(value, curve.Params().N))}
+	}
+	sharesJson, _ := json.Marshal(shares)
+	return string(sharesJson)
+}
+
+// complaint returns the shared key of the share dealer sent the trustee and
+// its proof under label.
+func (c *ceremonyTrustee) complaint(t *testing.T, stub *testStub, electionID string, dealer *ceremonyTrustee, label string) (string, string) {
+	dealing, err := getDealing(stub, electionID, dealer.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := decodePoint(dealing.Shares[c.ID].R)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proofJson, _ := json.Marshal(proveEqualLogs(t, label, c.x, r))
+	return r.mul(c.x).encode(), string(proofJson)
+}
+
+func TestKeyCeremonyDisqualifiesCheatingDealer(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 3000)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	trustees := newCeremonyTrustees(t, 3, 2)
+	honest, victim, cheater := trustees[0], trustees[1], trustees[2]
+	boundLabel := func(dealer, trustee *ceremonyTrustee) string {
+		return bindLabel(complaintLabel, "e", dealer.ID, trustee.ID)
+	}
+
+	stub.mustInvoke(t, admin, "initializationInvokation", "e", testElectionJson(10, keyCeremonyJson(2, 600, trustees)+","+lifecycleTestElection))
+	stub.expectError(t, "Key ceremony hasn't finished yet", admin, "transitionElection", "e", string(StateScheduled))
+	for _, trustee := range trustees {
+		stub.mustInvoke(t, trustee.testIdentity, "registerTrustee", "e", basePoint().mul(trustee.x).encode())
+	}
+	commitments, proof := honest.commitments(t, commitmentLabel)
+	stub.expectError(t, "Constant term: proof doesn't verify", honest.testIdentity, "publishCommitments", "e", commitments, proof)
+	for _, trustee := range trustees[:2] {
+		commitments, proof := trustee.commitments(t, bindLabel(commitmentLabel, "e", trustee.ID))
+		stub.mustInvoke(t, trustee.testIdentity, "publishCommitments", "e", commitments, proof)
+	}
+	stub.expectError(t, "Trustee "+cheater.ID+" hasn't published commitments yet", honest.testIdentity, "dealShares", "e", honest.shares(t, trustees, nil, 0))
+	commitments, proof = cheater.commitments(t, bindLabel(commitmentLabel, "e", cheater.ID))
+	stub.mustInvoke(t, cheater.testIdentity, "publishCommitments", "e", commitments, proof)
+
+	stub.mustInvoke(t, honest.testIdentity, "dealShares", "e", honest.shares(t, trustees, nil, 0))
+	stub.mustInvoke(t, victim.testIdentity, "dealShares", "e", victim.shares(t, trustees, nil, 0))
+	stub.mustInvoke(t, cheater.testIdentity, "dealShares", "e", cheater.shares(t, trustees, victim, 1))
+
+	// Complaints about a matching share and unbound proofs are rejected.
+	sharedKey, proof := victim.complaint(t, stub, "e", honest, boundLabel(honest, victim))
+	stub.expectError(t, "Share matches the commitments of the dealer", victim.testIdentity, "fileComplaint", "e", honest.ID, sharedKey, proof)
+	for _, label := range []string{complaintLabel, boundLabel(honest, victim), bindLabel(complaintLabel, "other", cheater.ID, victim.ID)} {
+		sharedKey, proof := victim.complaint(t, stub, "e", cheater, label)
+		stub.expectError(t, "Shared key: proof doesn't verify", victim.testIdentity, "fileComplaint", "e", cheater.ID, sharedKey, proof)
+	}
+	sharedKey, proof = victim.complaint(t, stub, "e", cheater, boundLabel(cheater, victim))
+	stub.mustInvoke(t, victim.testIdentity, "fileComplaint", "e", cheater.ID, sharedKey, proof)
+	var complaint Complaint
+	err := json.Unmarshal(stub.events["DealerDisqualified"], &complaint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if complaint.DealerID != cheater.ID || complaint.TrusteeID != victim.ID {
+		t.Errorf("unexpected complaint %+v", complaint)
+	}
+	stub.expectError(t, "Trustee already complained about this dealer", victim.testIdentity, "fileComplaint", "e", cheater.ID, sharedKey, proof)
+
+	// The complaint period ends when the ceremony may finish.
+	stub.expectError(t, "are accepted until", admin, "finishKeyCeremony", "e")
+	setClock(frozen, testStartDate-3000+600)
+	sharedKey, proof = honest.complaint(t, stub, "e", cheater, boundLabel(cheater, honest))
+	stub.expectError(t, "Complaints about the shares of "+cheater.ID+" were accepted until", honest.testIdentity, "fileComplaint", "e", cheater.ID, sharedKey, proof)
+	stub.expectError(t, "User isn't admin", honest.testIdentity, "finishKeyCeremony", "e")
+	var encryption Encryption
+	err = json.Unmarshal(stub.mustInvoke(t, admin, "finishKeyCeremony", "e"), &encryption)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The key is made up of the honest dealings only.
+	dealers := append([]string(nil), encryption.Dealers...)
+	sort.Strings(dealers)
+	expectedDealers := []string{honest.ID, victim.ID}
+	sort.Strings(expectedDealers)
+	if !reflect.DeepEqual(dealers, expectedDealers) {
+		t.Errorf("dealers %v, expected %v", dealers, expectedDealers)
+	}
+	g := basePoint()
+	if publicKey := g.mul(honest.coefficients[0]).add(g.mul(victim.coefficients[0])).encode(); encryption.PublicKey != publicKey {
+		t.Errorf("public key %s, expected %s", encryption.PublicKey, publicKey)
+	}
+	for i, trustee := range encryption.Trustees {
+		share := new(big.Int).Add(evaluatePolynomial(honest.coefficients, trustee.Index), evaluatePolynomial(victim.coefficients, trustee.Index))
+		if publicShare := g.mul(share).encode(); trustee.PublicShare != publicShare {
+			t.Errorf("public share of trustees[%d] %s, expected %s", i, trustee.PublicShare, publicShare)
+		}
+	}
+	stub.expectError(t, "Key ceremony already finished", victim.testIdentity, "fileComplaint", "e", cheater.ID, sharedKey, proof)
+	stub.mustInvoke(t, admin, "transitionElection", "e", string(StateScheduled))
+}
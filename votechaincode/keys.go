@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Object types of the composite keys every election is namespaced with.
+// Each key starts with the election ID so all state of one election can be
+// found with a partial composite key query.
+const (
+	initObjectType = "init"
+	voteObjectType = "vote"
+)
+
+const maxIDLength = 64
+
+// validateElectionID checks that an election ID is usable as a key
+// attribute and readable in URLs and logs.
+func validateElectionID(electionID string) error {
+	return validateID("Election ID", electionID)
+}
+
+// validateID checks that an identifier only consists of letters, digits,
+// '-', '_' and '.'. name is used in the error message.
+func validateID(name, id string) error {
+	if id == "" {
+		return errors.New(name + " must not be empty")
+	}
+	if len(id) > maxIDLength {
+		return errors.New(name + " must not be longer than " + strconv.Itoa(maxIDLength) + " characters")
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return errors.New(name + " may only contain letters, digits, '-', '_' and '.'")
+		}
+	}
+	return nil
+}
+
+// initKey is the key ElectionData of an election is stored under.
+func initKey(stub shim.ChaincodeStubInterface, electionID string) (string, error) {
+	return stub.CreateCompositeKey(initObjectType, []string{electionID})
+}
+
+// voteKey is the key the ballot of a voter in an election is stored under.
+func voteKey(stub shim.ChaincodeStubInterface, electionID, voterID string) (string, error) {
+	return stub.CreateCompositeKey(voteObjectType, []string{electionID, voterID})
+}
+
+// votesIterator iterates over all ballots of an election.
+func votesIterator(stub shim.ChaincodeStubInterface, electionID string) (shim.StateQueryIteratorInterface, error) {
+	return stub.GetStateByPartialCompositeKey(voteObjectType, []string{electionID})
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const lifecycleObjectType = "lifecycle"
+
+// ElectionState is a stage of the election lifecycle
+// Draft → Scheduled → Open ⇄ Paused → Closed → Tallied → Certified → Archived.
+type ElectionState string
+
+const (
+	StateDraft     ElectionState = "Draft"
+	StateScheduled ElectionState = "Scheduled"
+	StateOpen      ElectionState = "Open"
+	StatePaused    ElectionState = "Paused"
+	StateClosed    ElectionState = "Closed"
+	StateTallied   ElectionState = "Tallied"
+	StateCertified ElectionState = "Certified"
+	StateArchived  ElectionState = "Archived"
+)
+
+// systemActor is recorded as the actor of transitions that happen because
+// of the clock or an end condition rather than an admin.
+const systemActor = "system"
+
+// adminTransitions lists the transitions an admin may request through
+// transitionElection. Scheduled → Open and Open → Closed additionally happen
+// on their own once startDate, endDate or the end condition are reached.
+// Archived is only reached through destructionInvokation.
+var adminTransitions = map[ElectionState][]ElectionState{
+	StateDraft:     {StateScheduled},
+	StateScheduled: {StateDraft},
+	StateOpen:      {StatePaused, StateClosed},
+	StatePaused:    {StateOpen, StateClosed},
+	StateClosed:    {StateTallied},
+	StateTallied:   {StateCertified},
+}
+
+// Transition is a single entry of the lifecycle history.
+type Transition struct {
+	From   ElectionState `json:"from,omitempty"`
+	To     ElectionState `json:"to"`
+	By     string        `json:"by"`
+	At     int64         `json:"at"`
+	TxID   string        `json:"txID"`
+	Reason string        `json:"reason,omitempty"`
+}
+
+// Pause records one interruption of voting through pauseElection.
+// EndDateExtension is the number of seconds endDate was moved on resume.
+type Pause struct {
+	Reason           string `json:"reason"`
+	PausedBy         string `json:"pausedBy"`
+	PausedAt         int64  `json:"pausedAt"`
+	ResumedBy        string `json:"resumedBy,omitempty"`
+	ResumedAt        int64  `json:"resumedAt,omitempty"`
+	EndDateExtension int64  `json:"endDateExtension,omitempty"`
+}
+
+// Lifecycle is the persisted state of an election and how it got there.
+type Lifecycle struct {
+	State   ElectionState `json:"state"`
+	History []Transition  `json:"history"`
+	Pauses  []Pause       `json:"pauses,omitempty"`
+
+	// ManualCloseRequested is set by requestManualClose and reaches
+	// ManualCloseCondition.
+	ManualCloseRequested bool `json:"manualCloseRequested,omitempty"`
+
+	changed bool
+}
+
+func lifecycleKey(stub shim.ChaincodeStubInterface, electionID string) (string, error) {
+	return stub.CreateCompositeKey(lifecycleObjectType, []string{electionID})
+}
+
+// hasStarted reports whether voting has been opened at some point, i.e. the
+// election is past Scheduled.
+func (l *Lifecycle) hasStarted() bool {
+	return l.State != StateDraft && l.State != StateScheduled
+}
+
+// hasEnded reports whether voting is over for good.
+func (l *Lifecycle) hasEnded() bool {
+	return l.hasStarted() && l.State != StateOpen && l.State != StatePaused
+}
+
+// canTransition reports whether an admin may move the election from its
+// current state to target.
+func (l *Lifecycle) canTransition(target ElectionState) bool {
+	for _, allowed := range adminTransitions[l.State] {
+		if allowed == target {
+			return true
+		}
+	}
+	return false
+}
+
+// activePause returns the pause the election is currently in, or nil.
+func (l *Lifecycle) activePause() *Pause {
+	if l.State != StatePaused || len(l.Pauses) == 0 {
+		return nil
+	}
+	return &l.Pauses[len(l.Pauses)-1]
+}
+
+// transition moves the lifecycle to target now and records it in the
+// history.
+func (l *Lifecycle) transition(stub shim.ChaincodeStubInterface, target ElectionState, by, reason string) error {
+	now, err := nowUnix(stub)
+	if err != nil {
+		return err
+	}
+	l.transitionAt(stub, target, by, reason, now)
+	return nil
+}
+
+// transitionAt moves the lifecycle to target and records it in the history
+// as happened at the given time. Entering Paused starts a Pause record with
+// reason, leaving it ends that record.
+func (l *Lifecycle) transitionAt(stub shim.ChaincodeStubInterface, target ElectionState, by, reason string, now int64) {
+	if pause := l.activePause(); pause != nil && target != StatePaused {
+		pause.ResumedBy = by
+		pause.ResumedAt = now
+	}
+	if target == StatePaused {
+		l.Pauses = append(l.Pauses, Pause{
+			Reason:   reason,
+			PausedBy: by,
+			PausedAt: now,
+		})
+	}
+	l.History = append(l.History, Transition{
+		From:   l.State,
+		To:     target,
+		By:     by,
+		At:     now,
+		TxID:   stub.GetTxID(),
+		Reason: reason,
+	})
+	l.State = target
+	l.changed = true
+}
+
+// newLifecycle creates the lifecycle of a freshly initialized election.
+func newLifecycle(stub shim.ChaincodeStubInterface, adminID string) (*Lifecycle, error) {
+	lifecycle := &Lifecycle{History: []Transition{}}
+	err := lifecycle.transition(stub, StateDraft, adminID, "initialized")
+	if err != nil {
+		return nil, err
+	}
+	return lifecycle, nil
+}
+
+// getLifecycle loads the persisted lifecycle of an election and applies the
+// transitions that are due because startDate or endDate passed according to
+// clock. They are recorded as happened at startDate and endDate and are
+// only kept in memory; callers that write state persist them with
+// putLifecycle. Paused elections close at endDate too, unless their endDate
+// is extended when they are resumed.
+func getLifecycle(stub shim.ChaincodeStubInterface, electionID string, electionData *ElectionData) (*Lifecycle, error) {
+	key, err := lifecycleKey(stub, electionID)
+	if err != nil {
+		return nil, err
+	}
+	stateBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get state")
+	}
+	if stateBytes == nil {
+		return nil, errors.New("Lifecycle of election " + electionID + " not set")
+	}
+	var lifecycle Lifecycle
+	err = json.Unmarshal(stateBytes, &lifecycle)
+	if err != nil {
+		return nil, errors.New("Stored lifecycle couldn't be parsed")
+	}
+
+	startTime := time.Unix(electionData.StartDate, 0)
+	endTime := time.Unix(electionData.EndDate, 0)
+	now, err := clock.Now(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	if lifecycle.State == StateScheduled && now.After(startTime) {
+		lifecycle.transitionAt(stub, StateOpen, systemActor, "startDate reached", electionData.StartDate)
+	}
+	closesAtEnd := lifecycle.State == StateOpen || lifecycle.State == StatePaused && !electionData.ExtendEndDateOnPause
+	if closesAtEnd && now.After(endTime) {
+		lifecycle.transitionAt(stub, StateClosed, systemActor, "endDate reached", electionData.EndDate)
+	}
+	return &lifecycle, nil
+}
+
+// getElection loads the ElectionData and the current lifecycle of an
+// election.
+func getElection(stub shim.ChaincodeStubInterface, electionID string) (*ElectionData, *Lifecycle, error) {
+	electionData, err := getElectionData(stub, electionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	lifecycle, err := getLifecycle(stub, electionID, electionData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return electionData, lifecycle, nil
+}
+
+// putLifecycle persists the lifecycle if it changed since it was loaded.
+func putLifecycle(stub shim.ChaincodeStubInterface, electionID string, lifecycle *Lifecycle) error {
+	if !lifecycle.changed {
+		return nil
+	}
+	key, err := lifecycleKey(stub, electionID)
+	if err != nil {
+		return err
+	}
+	lifecycleJson, err := json.Marshal(lifecycle)
+	if err != nil {
+		return errors.New("Failed to generate Json")
+	}
+	return stub.PutState(key, lifecycleJson)
+}
+
+// legacyStatus maps the lifecycle onto the "running"/"ended" status
+// electionStatusQuery reported before the lifecycle existed.
+func (l *Lifecycle) legacyStatus() string {
+	if l.hasEnded() {
+		return "ended"
+	}
+	return "running"
+}
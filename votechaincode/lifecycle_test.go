@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const lifecycleTestElection = `"candidates":[{"id":"a","name":"A"}],"endCondition":{"type":"TimeOnlyCondition"}`
+
+func TestAdminTransitionsAreGuarded(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	voter := newVoter(t, "voter")
+
+	stub.mustInvoke(t, admin, "initializationInvokation", "e", testElectionJson(10, lifecycleTestElection))
+	stub.expectError(t, "User isn't admin", voter, "transitionElection", "e", string(StateScheduled))
+	stub.expectError(t, "can't move from Draft to Open", admin, "transitionElection", "e", string(StateOpen))
+	stub.expectError(t, "can't move from Draft to Archived", admin, "transitionElection", "e", string(StateArchived))
+	stub.mustInvoke(t, admin, "transitionElection", "e", string(StateScheduled))
+	stub.mustInvoke(t, admin, "transitionElection", "e", string(StateDraft), "fix title")
+	stub.mustInvoke(t, admin, "transitionElection", "e", string(StateScheduled))
+	stub.expectError(t, "Election isn't running", voter, "voteInvokation", "e", `{"candidate":"a"}`)
+
+	setClock(frozen, testStartDate+1)
+	if state := electionState(t, stub, "e"); state != StateOpen {
+		t.Fatalf("state %s at startDate, expected Open", state)
+	}
+	stub.expectError(t, "Use pauseElection", admin, "transitionElection", "e", string(StatePaused))
+	stub.expectError(t, "can't move from Open to Tallied", admin, "transitionElection", "e", string(StateTallied))
+	stub.mustInvoke(t, voter, "voteInvokation", "e", `{"candidate":"a"}`)
+	stub.mustInvoke(t, admin, "transitionElection", "e", string(StateClosed), "counted early")
+	stub.expectError(t, "Election isn't running", newVoter(t, "late"), "voteInvokation", "e", `{"candidate":"a"}`)
+	stub.expectError(t, "can't move from Closed to Open", admin, "transitionElection", "e", string(StateOpen))
+	stub.mustInvoke(t, admin, "transitionElection", "e", string(StateTallied))
+	stub.mustInvoke(t, admin, "transitionElection", "e", string(StateCertified))
+	stub.expectError(t, "can't move from Certified to Closed", admin, "transitionElection", "e", string(StateClosed))
+
+	var status ElectionStatus
+	err := json.Unmarshal(stub.mustInvoke(t, voter, "electionStatusQuery", "e"), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ElectionState{StateDraft, StateScheduled, StateDraft, StateScheduled, StateOpen, StateClosed, StateTallied, StateCertified}
+	if len(status.History) != len(expected) {
+		t.Fatalf("history %+v, expected %v", status.History, expected)
+	}
+	for i, transition := range status.History {
+		if transition.To != expected[i] {
+			t.Errorf("transition %d to %s, expected %s", i, transition.To, expected[i])
+		}
+	}
+	closed := status.History[5]
+	if closed.By != admin.ID || closed.Reason != "counted early" || closed.At != testStartDate+1 {
+		t.Errorf("unexpected close transition %+v", closed)
+	}
+	if opened := status.History[4]; opened.By != systemActor || opened.At != testStartDate {
+		t.Errorf("unexpected open transition %+v", opened)
+	}
+	if status.Status != "ended" {
+		t.Errorf("status %q, expected ended", status.Status)
+	}
+}
+
+func TestResetOfRunningElectionNeedsReason(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	voter := newVoter(t, "voter")
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, lifecycleTestElection))
+	stub.mustInvoke(t, voter, "voteInvokation", "e", `{"candidate":"a"}`)
+	stub.expectError(t, "Election is Open, resetting it needs a reason", admin, "destructionInvokation", "e")
+	stub.expectError(t, "Election is Open, resetting it needs a reason", admin, "destructionInvokation", "e", "")
+	stub.mustInvoke(t, admin, "destructionInvokation", "e", "wrong candidates")
+
+	// The election never closed, so its archived ballots and tally stay
+	// hidden like its results were.
+	var records []ArchiveRecord
+	err := json.Unmarshal(stub.mustInvoke(t, voter, "archivesQuery", "e"), &records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("voter sees %d archive records of an election reset while open", len(records))
+	}
+	auditor := newIdentity(t, "auditor", map[string]string{"auditor": "true"})
+	err = json.Unmarshal(stub.mustInvoke(t, auditor, "archivesQuery", "e"), &records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Lifecycle.History[len(records[0].Lifecycle.History)-1].Reason != "wrong candidates" {
+		t.Errorf("auditor sees %+v, expected the record with the reason", records)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// PauseEvent is the payload of the ElectionPaused and ElectionResumed
+// chaincode events.
+type PauseEvent struct {
+	ElectionID string `json:"electionID"`
+	Pause      Pause  `json:"pause"`
+}
+
+// Pause voting in an open election. Expects the election ID and the reason
+// for the pause.
+func (t *VoteChaincode) pauseElection(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err := cid.AssertAttributeValue(stub, "admin", "true")
+	if err != nil {
+		return shim.Error("User isn't admin")
+	}
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID and the reason for the pause")
+	}
+	electionID := args[0]
+	reason := strings.TrimSpace(args[1])
+	if reason == "" {
+		return shim.Error("A reason for the pause is required")
+	}
+
+	_, lifecycle, err := getElection(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if lifecycle.State != StateOpen {
+		return shim.Error("Only an open election can be paused, election is " + string(lifecycle.State))
+	}
+	adminID, err := cid.GetID(stub)
+	if err != nil {
+		return shim.Error("Couldn't read ID from stub.")
+	}
+	err = lifecycle.transition(stub, StatePaused, adminID, reason)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putLifecycle(stub, electionID, lifecycle)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = setPauseEvent(stub, "ElectionPaused", electionID, lifecycle.Pauses[len(lifecycle.Pauses)-1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("Election " + electionID + " paused by " + adminID + ": " + reason)
+	return shim.Success(nil)
+}
+
+// Resume a paused election. If the election has extendEndDateOnPause set,
+// endDate is moved by the length of the pause.
+func (t *VoteChaincode) resumeElection(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err := cid.AssertAttributeValue(stub, "admin", "true")
+	if err != nil {
+		return shim.Error("User isn't admin")
+	}
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID")
+	}
+	electionID := args[0]
+
+	electionData, lifecycle, err := getElection(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if lifecycle.State != StatePaused {
+		return shim.Error("Only a paused election can be resumed, election is " + string(lifecycle.State))
+	}
+	adminID, err := cid.GetID(stub)
+	if err != nil {
+		return shim.Error("Couldn't read ID from stub.")
+	}
+	pauseIndex := len(lifecycle.Pauses) - 1
+	err = lifecycle.transition(stub, StateOpen, adminID, "resumed")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	pause := &lifecycle.Pauses[pauseIndex]
+	if electionData.ExtendEndDateOnPause {
+		pause.EndDateExtension = pause.ResumedAt - pause.PausedAt
+		electionData.EndDate += pause.EndDateExtension
+		err = putElectionData(stub, electionID, electionData)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		fmt.Println("endDate of election " + electionID + " extended to " + strconv.FormatInt(electionData.EndDate, 10))
+	}
+	err = putLifecycle(stub, electionID, lifecycle)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = setPauseEvent(stub, "ElectionResumed", electionID, *pause)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("Election " + electionID + " resumed by " + adminID)
+	return shim.Success(nil)
+}
+
+func setPauseEvent(stub shim.ChaincodeStubInterface, name, electionID string, pause Pause) error {
+	eventJson, err := json.Marshal(PauseEvent{ElectionID: electionID, Pause: pause})
+	if err != nil {
+		return err
+	}
+	return stub.SetEvent(name, eventJson)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPauseAndResume(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	voter := newVoter(t, "voter")
+
+	stub.mustInvoke(t, admin, "initializationInvokation", "e", testElectionJson(10, lifecycleTestElection))
+	stub.expectError(t, "Only an open election can be paused, election is Draft", admin, "pauseElection", "e", "outage")
+	stub.mustInvoke(t, admin, "transitionElection", "e", string(StateScheduled))
+	setClock(frozen, testStartDate+100)
+
+	stub.expectError(t, "User isn't admin", voter, "pauseElection", "e", "outage")
+	stub.expectError(t, "A reason for the pause is required", admin, "pauseElection", "e", " ")
+	stub.mustInvoke(t, admin, "pauseElection", "e", "outage")
+	var event PauseEvent
+	err := json.Unmarshal(stub.events["ElectionPaused"], &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ElectionID != "e" || event.Pause.Reason != "outage" || event.Pause.PausedBy != admin.ID || event.Pause.PausedAt != testStartDate+100 {
+		t.Errorf("unexpected pause event %+v", event)
+	}
+	stub.expectError(t, "Election isn't running", voter, "voteInvokation", "e", `{"candidate":"a"}`)
+	stub.expectError(t, "Only an open election can be paused, election is Paused", admin, "pauseElection", "e", "again")
+
+	setClock(frozen, testStartDate+700)
+	stub.expectError(t, "User isn't admin", voter, "resumeElection", "e")
+	stub.mustInvoke(t, admin, "resumeElection", "e")
+	err = json.Unmarshal(stub.events["ElectionResumed"], &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Pause.ResumedBy != admin.ID || event.Pause.ResumedAt != testStartDate+700 || event.Pause.EndDateExtension != 0 {
+		t.Errorf("unexpected resume event %+v", event)
+	}
+	stub.expectError(t, "Only a paused election can be resumed, election is Open", admin, "resumeElection", "e")
+	stub.mustInvoke(t, voter, "voteInvokation", "e", `{"candidate":"a"}`)
+
+	var status ElectionStatus
+	err = json.Unmarshal(stub.mustInvoke(t, voter, "electionStatusQuery", "e"), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Pauses) != 1 || status.Pause != nil || status.Pauses[0].Reason != "outage" {
+		t.Errorf("unexpected pauses %+v", status.Pauses)
+	}
+	electionData, err := getElectionData(stub, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if electionData.EndDate != testEndDate {
+		t.Errorf("endDate moved to %d without extendEndDateOnPause", electionData.EndDate)
+	}
+}
+
+func TestPausedElectionClosesAtEndDate(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, lifecycleTestElection))
+	stub.mustInvoke(t, admin, "pauseElection", "e", "outage")
+	setClock(frozen, testEndDate)
+	if state := electionState(t, stub, "e"); state != StatePaused {
+		t.Fatalf("state %s at endDate, expected Paused", state)
+	}
+	setClock(frozen, testEndDate+1)
+	if state := electionState(t, stub, "e"); state != StateClosed {
+		t.Fatalf("state %s after endDate, expected Closed", state)
+	}
+	stub.expectError(t, "Only a paused election can be resumed, election is Closed", admin, "resumeElection", "e")
+}
+
+func TestResumeExtendsEndDate(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, lifecycleTestElection+`,"extendEndDateOnPause":true`))
+	setClock(frozen, testEndDate-100)
+	stub.mustInvoke(t, admin, "pauseElection", "e", "outage")
+	// Paused elections that are extended on resume don't close at endDate.
+	setClock(frozen, testEndDate+500)
+	if state := electionState(t, stub, "e"); state != StatePaused {
+		t.Fatalf("state %s after endDate, expected Paused", state)
+	}
+	stub.mustInvoke(t, admin, "resumeElection", "e")
+
+	electionData, err := getElectionData(stub, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if electionData.EndDate != testEndDate+600 {
+		t.Errorf("endDate %d, expected it extended by the 600 seconds of the pause", electionData.EndDate)
+	}
+	var event PauseEvent
+	err = json.Unmarshal(stub.events["ElectionResumed"], &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Pause.EndDateExtension != 600 {
+		t.Errorf("extension %d, expected 600", event.Pause.EndDateExtension)
+	}
+	stub.mustInvoke(t, newVoter(t, "voter"), "voteInvokation", "e", `{"candidate":"a"}`)
+	setClock(frozen, testEndDate+601)
+	if state := electionState(t, stub, "e"); state != StateClosed {
+		t.Fatalf("state %s after the extended endDate, expected Closed", state)
+	}
+}
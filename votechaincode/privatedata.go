@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Keys of the ballot and its salt in the transient map of a voteInvokation
+// of a private election.
+const (
+	transientBallotKey = "ballot"
+	transientSaltKey   = "salt"
+)
+
+// minSaltLength is the minimum number of bytes of a ballot salt.
+const minSaltLength = 16
+
+// PrivateData keeps the ballots of an election off the channel ledger. They
+// are stored in the private data collection Collection under their vote key
+// together with a random salt, and the ledger only gets the hex encoded
+// SHA-256 of the salt followed by the ballot. Without the salt the few
+// possible ballots could simply be hashed and compared. Voters pass their
+// ballot and salt in the transient map under "ballot" and "salt" so that
+// neither is part of the transaction. Ballots can only be read on peers of
+// the organizations in the collection.
+type PrivateData struct {
+	Collection string `json:"collection"`
+}
+
+// PrivateBallot is what a private election stores in its collection.
+type PrivateBallot struct {
+	Salt   []byte          `json:"salt"`
+	Ballot json.RawMessage `json:"ballot"`
+}
+
+// hash returns the hex encoded SHA-256 of the salt followed by the ballot.
+func (p *PrivateBallot) hash() string {
+	sum := sha256.Sum256(append(append([]byte{}, p.Salt...), p.Ballot...))
+	return hex.EncodeToString(sum[:])
+}
+
+func (p *PrivateData) validate(electionData *ElectionData, field string, verr *ValidationError) {
+	if p.Collection == "" {
+		verr.add(field+".collection", "must not be empty")
+	}
+	if electionData.CommitReveal != nil {
+		verr.add(field, "can't be combined with commitReveal")
+	}
+}
+
+// submittedBallot returns the ballot JSON of a voteInvokation, args[1] or
+// for private elections the ballot from the transient map, and for private
+// elections the salt from the transient map.
+func submittedBallot(stub shim.ChaincodeStubInterface, electionData *ElectionData, args []string) ([]byte, []byte, error) {
+	if electionData.PrivateData == nil {
+		if len(args) != 2 {
+			return nil, nil, errors.New("Incorrect number of arguments. Expecting the election ID and a JSON string representing a Vote")
+		}
+		return []byte(args[1]), nil, nil
+	}
+	if len(args) != 1 {
+		return nil, nil, errors.New("Ballots of private elections must be passed in the transient map, not as an argument")
+	}
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return nil, nil, errors.New("Couldn't read transient map from stub.")
+	}
+	ballot := transient[transientBallotKey]
+	if len(ballot) == 0 {
+		return nil, nil, errors.New("No ballot in the transient map under \"" + transientBallotKey + "\"")
+	}
+	salt := transient[transientSaltKey]
+	if len(salt) < minSaltLength {
+		return nil, nil, errors.New("Expecting at least " + strconv.Itoa(minSaltLength) + " random bytes in the transient map under \"" + transientSaltKey + "\"")
+	}
+	return ballot, salt, nil
+}
+
+// putBallot stores a ballot under its vote key, for private elections in
+// the collection together with salt and their hash on the ledger.
+func putBallot(stub shim.ChaincodeStubInterface, electionData *ElectionData, key string, ballot, salt []byte) error {
+	if electionData.PrivateData == nil {
+		return stub.PutState(key, ballot)
+	}
+	private := &PrivateBallot{Salt: salt, Ballot: ballot}
+	privateJson, err := json.Marshal(private)
+	if err != nil {
+		return errors.New("Failed to generate Json")
+	}
+	err = stub.PutPrivateData(electionData.PrivateData.Collection, key, privateJson)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, []byte(private.hash()))
+}
+
+// readPrivateBallot returns the private copy of the ballot stored under key
+// given the hash on the ledger, which it must match.
+func readPrivateBallot(stub shim.ChaincodeStubInterface, electionData *ElectionData, key string, stored []byte) (*PrivateBallot, error) {
+	privateJson, err := stub.GetPrivateData(electionData.PrivateData.Collection, key)
+	if err != nil {
+		return nil, errors.New("Failed to get private data")
+	}
+	if privateJson == nil {
+		return nil, errors.New("Ballots of the election aren't available on this peer")
+	}
+	var private PrivateBallot
+	err = json.Unmarshal(privateJson, &private)
+	if err != nil {
+		return nil, errors.New("Stored private ballot couldn't be parsed")
+	}
+	if private.hash() != string(stored) {
+		return nil, errors.New("Private ballot doesn't match its hash on the ledger")
+	}
+	return &private, nil
+}
+
+// readBallot returns the ballot stored under key given the value on the
+// ledger. For private elections that is the private copy, which must match
+// the hash on the ledger.
+func readBallot(stub shim.ChaincodeStubInterface, electionData *ElectionData, key string, stored []byte) ([]byte, error) {
+	if electionData.PrivateData == nil || stored == nil {
+		return stored, nil
+	}
+	private, err := readPrivateBallot(stub, electionData, key, stored)
+	if err != nil {
+		return nil, err
+	}
+	return private.Ballot, nil
+}
+
+// archivedBallotHash returns the hash a ballot is archived with. Private
+// ballots keep the salted hash from the ledger, any other hash of them
+// could be reversed by hashing the possible ballots.
+func archivedBallotHash(stub shim.ChaincodeStubInterface, electionData *ElectionData, key string, ballot []byte) (string, error) {
+	if electionData.PrivateData == nil {
+		return hashBallot(ballot), nil
+	}
+	stored, err := stub.GetState(key)
+	if err != nil {
+		return "", errors.New("Failed to get state")
+	}
+	return string(stored), nil
+}
+
+// deletePrivateBallots removes the private copies of the ballots stored
+// under voteKeys.
+func deletePrivateBallots(stub shim.ChaincodeStubInterface, electionData *ElectionData, voteKeys []string) error {
+	if electionData.PrivateData == nil {
+		return nil
+	}
+	for _, key := range voteKeys {
+		err := stub.DelPrivateData(electionData.PrivateData.Collection, key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const privateTestElection = `"privateData":{"collection":"ballots"},"candidates":[{"id":"a","name":"A"},{"id":"b","name":"B"}],"endCondition":{"type":"TimeOnlyCondition"}`
+
+// privateBallot returns the transient map of a private ballot.
+func privateBallot(ballot, salt string) map[string][]byte {
+	return map[string][]byte{transientBallotKey: []byte(ballot), transientSaltKey: []byte(salt)}
+}
+
+func TestPrivateBallotsStayInTheCollection(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	alice := newVoter(t, "alice")
+	bob := newVoter(t, "bob")
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, privateTestElection))
+	stub.expectError(t, "Ballots of private elections must be passed in the transient map, not as an argument", alice, "voteInvokation", "e", `{"candidate":"a"}`)
+	transients := map[string]map[string][]byte{
+		`No ballot in the transient map under "ballot"`:                        {transientSaltKey: []byte(testSalt)},
+		`Expecting at least 16 random bytes in the transient map under "salt"`: privateBallot(`{"candidate":"a"}`, "salt"),
+		"Invalid ballot": privateBallot(`{"candidate":"c"}`, testSalt),
+	}
+	for message, transient := range transients {
+		response := stub.invokeTransient(alice, transient, "voteInvokation", "e")
+		if response.Status == shim.OK || !strings.Contains(response.Message, message) {
+			t.Errorf("voteInvokation with %q returned %q, expected %q", transient, response.Message, message)
+		}
+	}
+	for i, voter := range []testIdentity{alice, bob} {
+		ballot := `{"candidate":"` + []string{"a", "b"}[i] + `"}`
+		response := stub.invokeTransient(voter, privateBallot(ballot, testSalt), "voteInvokation", "e")
+		if response.Status != shim.OK {
+			t.Fatalf("private ballot %s rejected: %s", ballot, response.Message)
+		}
+	}
+
+	// The ledger only holds the salted hash of the recorded ballot, the voter
+	// can check it.
+	recorded := `{"candidate":"a","org":"` + testMSPID + `"}`
+	key, err := voteKey(stub, "e", alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := stub.GetState(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(testSalt + recorded))
+	if string(stored) != hex.EncodeToString(sum[:]) {
+		t.Errorf("ledger holds %q, expected the salted hash of the ballot", stored)
+	}
+	var private PrivateBallot
+	err = json.Unmarshal(stub.mustInvoke(t, alice, "ownVoteQuery", "e"), &private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(private.Salt) != testSalt || string(private.Ballot) != recorded {
+		t.Errorf("own vote %+v, expected the ballot and salt", private)
+	}
+
+	setClock(frozen, testEndDate+1)
+	tally := queryTally(t, stub, admin, "e")
+	if !reflect.DeepEqual(tally.Results, []CandidateResult{{"a", "A", 1}, {"b", "B", 1}}) {
+		t.Errorf("results %+v, expected a 1 and b 1", tally.Results)
+	}
+
+	// Peers of organizations outside the collection can't read the ballots.
+	stub.noCollection = true
+	stub.expectError(t, "Ballots of the election aren't available on this peer", admin, "tallyQuery", "e")
+	stub.expectError(t, "Ballots of the election aren't available on this peer", admin, "allVotesQuery", "e")
+	stub.expectError(t, "Ballots of the election aren't available on this peer", alice, "ownVoteQuery", "e")
+	stub.noCollection = false
+
+	// A private copy altered on a peer no longer matches the ledger.
+	tampered, _ := json.Marshal(PrivateBallot{Salt: []byte(testSalt), Ballot: json.RawMessage(`{"candidate":"b","org":"` + testMSPID + `"}`)})
+	stub.collections["ballots"][key] = tampered
+	stub.expectError(t, "Private ballot doesn't match its hash on the ledger", alice, "ownVoteQuery", "e")
+	stub.expectError(t, "Private ballot doesn't match its hash on the ledger", admin, "allVotesQuery", "e")
+}
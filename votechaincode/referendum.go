@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Referendum choices.
+const (
+	ChoiceYes     = "yes"
+	ChoiceNo      = "no"
+	ChoiceAbstain = "abstain"
+)
+
+// Referendum pass thresholds.
+const (
+	// SimpleThreshold passes with more yes than no votes.
+	SimpleThreshold = "simple"
+	// AbsoluteThreshold passes with yes votes from more than half of
+	// voterCount, or of the total weight in weighted elections.
+	AbsoluteThreshold = "absolute"
+	// SupermajorityThreshold passes if at least the Majority fraction of
+	// the yes and no votes are yes.
+	SupermajorityThreshold = "supermajority"
+	// DoubleMajorityThreshold passes with more yes than no votes overall
+	// and in more than half of Orgs.
+	DoubleMajorityThreshold = "doubleMajority"
+)
+
+// Referendum outcomes.
+const (
+	OutcomePassed           = "passed"
+	OutcomeFailed           = "failed"
+	OutcomeInvalidForQuorum = "invalidForQuorum"
+)
+
+// ReferendumRules decide when a referendum passes. Abstentions count towards
+// the quorum but never for or against the motion.
+type ReferendumRules struct {
+	Threshold string    `json:"threshold"`
+	Majority  *Fraction `json:"majority,omitempty"`
+	Orgs      []string  `json:"orgs,omitempty"`
+	// QuorumPercentage is the share of voterCount, or of the total weight
+	// in weighted elections, that must answer the referendum for its result
+	// to be valid.
+	QuorumPercentage int `json:"quorumPercentage,omitempty"`
+	// BlankCountsForQuorum counts blank answers towards the quorum like
+	// abstentions.
+	BlankCountsForQuorum bool `json:"blankCountsForQuorum,omitempty"`
+}
+
+// Fraction is an exact share like 2/3.
+type Fraction struct {
+	Numerator   int `json:"numerator"`
+	Denominator int `json:"denominator"`
+}
+
+// ReferendumResult is the outcome of a referendum. Turnout is the share of
+// the eligible weight that answered it in percent. In weighted elections
+// all votes are weights.
+type ReferendumResult struct {
+	Threshold     string      `json:"threshold"`
+	Yes           int         `json:"yes"`
+	No            int         `json:"no"`
+	Abstain       int         `json:"abstain"`
+	Turnout       float64     `json:"turnout"`
+	QuorumReached bool        `json:"quorumReached"`
+	Orgs          []OrgResult `json:"orgs,omitempty"`
+	Outcome       string      `json:"outcome"`
+}
+
+// OrgResult is the referendum result among the voters of one org.
+type OrgResult struct {
+	Org     string `json:"org"`
+	Yes     int    `json:"yes"`
+	No      int    `json:"no"`
+	Abstain int    `json:"abstain"`
+	Passed  bool   `json:"passed"`
+}
+
+// referendumMethod asks voters to answer a motion with yes, no or abstain.
+// The motion passes if the quorum is reached and the threshold of the
+// ReferendumRules is met.
+type referendumMethod struct{}
+
+func (referendumMethod) validateRules(rules *ContestRules, field string, verr *ValidationError) {
+	rejectSelectionLimits(rules, field, verr)
+	rejectSeats(rules, field, verr)
+	rejectWriteIns(rules, field, verr)
+	if len(rules.Candidates) != 0 {
+		verr.add(field+"candidates", "not used by referendums")
+	}
+	referendum := rules.Referendum
+	if referendum == nil {
+		verr.add(field+"referendum", "must be set")
+		return
+	}
+	field += "referendum."
+
+	switch referendum.Threshold {
+	case SimpleThreshold, AbsoluteThreshold:
+	case SupermajorityThreshold:
+		if referendum.Majority == nil {
+			verr.add(field+"majority", "must be set for a supermajority")
+		} else if referendum.Majority.Numerator <= 0 || referendum.Majority.Numerator >= referendum.Majority.Denominator {
+			verr.add(field+"majority", "must be a fraction between 0 and 1")
+		}
+	case DoubleMajorityThreshold:
+		if len(referendum.Orgs) < 2 {
+			verr.add(field+"orgs", "must contain at least two orgs")
+		}
+		seen := make(map[string]bool)
+		for i, org := range referendum.Orgs {
+			if org == "" || seen[org] {
+				verr.add(field+"orgs["+strconv.Itoa(i)+"]", "must be a unique MSP ID")
+			}
+			seen[org] = true
+		}
+	default:
+		verr.add(field+"threshold", "must be one of simple, absolute, supermajority, doubleMajority")
+	}
+	if referendum.Majority != nil && referendum.Threshold != SupermajorityThreshold {
+		verr.add(field+"majority", "only used by a supermajority")
+	}
+	if len(referendum.Orgs) != 0 && referendum.Threshold != DoubleMajorityThreshold {
+		verr.add(field+"orgs", "only used by a double majority")
+	}
+	if referendum.QuorumPercentage < 0 || referendum.QuorumPercentage > 100 {
+		verr.add(field+"quorumPercentage", "must be between 0 and 100")
+	}
+}
+
+func (referendumMethod) validateBallot(rules *ContestRules, ballot *Ballot) error {
+	err := ballot.expectFields("choice")
+	if err != nil {
+		return err
+	}
+	switch ballot.Choice {
+	case ChoiceYes, ChoiceNo, ChoiceAbstain:
+		return nil
+	case "":
+		return errors.New("no choice given")
+	}
+	return errors.New("choice must be yes, no or abstain")
+}
+
+// counters only counts the ballot. The choices aren't candidates, so
+// CandidatePercentileCondition must not see them.
+func (referendumMethod) counters(ballot *Ballot) *Counters {
+	counters := newCounters()
+	counters.Ballots = 1
+	return counters
+}
+
+// tally reports the three choices as Results and "yes" or "no" as the
+// winner once the outcome is valid.
+func (referendumMethod) tally(electionData *ElectionData, rules *ContestRules, ballots []*Ballot, tally *ContestTally) {
+	referendum := rules.Referendum
+	result := &ReferendumResult{Threshold: referendum.Threshold}
+	orgs := make(map[string]*OrgResult)
+	for _, org := range referendum.Orgs {
+		result.Orgs = append(result.Orgs, OrgResult{Org: org})
+	}
+	for i := range result.Orgs {
+		orgs[result.Orgs[i].Org] = &result.Orgs[i]
+	}
+
+	for _, ballot := range ballots {
+		org := orgs[ballot.Org]
+		if org == nil {
+			org = &OrgResult{}
+		}
+		switch ballot.Choice {
+		case ChoiceYes:
+			result.Yes += ballot.weight()
+			org.Yes += ballot.weight()
+		case ChoiceNo:
+			result.No += ballot.weight()
+			org.No += ballot.weight()
+		case ChoiceAbstain:
+			result.Abstain += ballot.weight()
+			org.Abstain += ballot.weight()
+		}
+	}
+
+	answers := result.Yes + result.No + result.Abstain
+	if referendum.BlankCountsForQuorum {
+		answers += tally.Blank
+	}
+	eligible := electionData.eligibleWeight()
+	result.Turnout = float64(answers) / float64(eligible) * 100
+	result.QuorumReached = answers*100 >= referendum.QuorumPercentage*eligible
+
+	passed := false
+	switch referendum.Threshold {
+	case SimpleThreshold:
+		passed = result.Yes > result.No
+	case AbsoluteThreshold:
+		passed = result.Yes*2 > eligible
+	case SupermajorityThreshold:
+		passed = result.Yes > 0 && result.Yes*referendum.Majority.Denominator >= referendum.Majority.Numerator*(result.Yes+result.No)
+	case DoubleMajorityThreshold:
+		orgsPassed := 0
+		for i := range result.Orgs {
+			result.Orgs[i].Passed = result.Orgs[i].Yes > result.Orgs[i].No
+			if result.Orgs[i].Passed {
+				orgsPassed++
+			}
+		}
+		passed = result.Yes > result.No && orgsPassed*2 > len(result.Orgs)
+	}
+
+	switch {
+	case !result.QuorumReached:
+		result.Outcome = OutcomeInvalidForQuorum
+	case passed:
+		result.Outcome = OutcomePassed
+		tally.Winners = []string{ChoiceYes}
+	default:
+		result.Outcome = OutcomeFailed
+		tally.Winners = []string{ChoiceNo}
+	}
+	tally.Results = []CandidateResult{
+		{CandidateID: ChoiceYes, Name: "Yes", Votes: result.Yes},
+		{CandidateID: ChoiceNo, Name: "No", Votes: result.No},
+		{CandidateID: ChoiceAbstain, Name: "Abstain", Votes: result.Abstain},
+	}
+	tally.Referendum = result
+}
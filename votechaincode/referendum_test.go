@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// choices returns count referendum ballots of org with the given choice.
+func choices(org, choice string, count int) []*Ballot {
+	ballots := make([]*Ballot, count)
+	for i := range ballots {
+		ballots[i] = &Ballot{Choice: choice, Org: org}
+	}
+	return ballots
+}
+
+// tallyReferendum tallies ballots of an election of ten voters under
+// referendum and returns the result. blank is the number of blank answers.
+func tallyReferendum(referendum *ReferendumRules, blank int, ballots ...[]*Ballot) *ReferendumResult {
+	electionData := &ElectionData{VoterCount: 10}
+	rules := &ContestRules{VotingMethod: ReferendumMethod, Referendum: referendum}
+	var all []*Ballot
+	for _, group := range ballots {
+		all = append(all, group...)
+	}
+	tally := &ContestTally{Blank: blank}
+	referendumMethod{}.tally(electionData, rules, all, tally)
+	return tally.Referendum
+}
+
+func TestReferendumThresholdsAndQuorum(t *testing.T) {
+	twoThirds := &ReferendumRules{Threshold: SupermajorityThreshold, Majority: &Fraction{2, 3}, QuorumPercentage: 50}
+	tests := []struct {
+		name    string
+		result  *ReferendumResult
+		outcome string
+	}{
+		{"exactly two thirds", tallyReferendum(twoThirds, 0, choices("", "yes", 4), choices("", "no", 2)), OutcomePassed},
+		{"short of two thirds", tallyReferendum(twoThirds, 0, choices("", "yes", 3), choices("", "no", 2)), OutcomeFailed},
+		{"short of the quorum", tallyReferendum(twoThirds, 0, choices("", "yes", 3), choices("", "no", 1)), OutcomeInvalidForQuorum},
+		{"abstentions reach the quorum", tallyReferendum(twoThirds, 0, choices("", "yes", 3), choices("", "no", 1), choices("", "abstain", 1)), OutcomePassed},
+		{"blank answers don't reach the quorum", tallyReferendum(twoThirds, 1, choices("", "yes", 3), choices("", "no", 1)), OutcomeInvalidForQuorum},
+		{"blank answers reach the quorum", tallyReferendum(&ReferendumRules{Threshold: SimpleThreshold, QuorumPercentage: 50, BlankCountsForQuorum: true}, 2, choices("", "yes", 2), choices("", "no", 1)), OutcomePassed},
+		{"simple tie", tallyReferendum(&ReferendumRules{Threshold: SimpleThreshold}, 0, choices("", "yes", 2), choices("", "no", 2)), OutcomeFailed},
+		{"absolute half", tallyReferendum(&ReferendumRules{Threshold: AbsoluteThreshold}, 0, choices("", "yes", 5)), OutcomeFailed},
+		{"absolute majority", tallyReferendum(&ReferendumRules{Threshold: AbsoluteThreshold}, 0, choices("", "yes", 6), choices("", "no", 1)), OutcomePassed},
+	}
+	for _, test := range tests {
+		if test.result.Outcome != test.outcome {
+			t.Errorf("%s: outcome %s, expected %s", test.name, test.result.Outcome, test.outcome)
+		}
+	}
+
+	result := tallyReferendum(twoThirds, 0, choices("", "yes", 3), choices("", "no", 1), choices("", "abstain", 1))
+	if result.Yes != 3 || result.No != 1 || result.Abstain != 1 || result.Turnout != 50 || !result.QuorumReached {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestReferendumDoubleMajority(t *testing.T) {
+	rules := &ReferendumRules{Threshold: DoubleMajorityThreshold, Orgs: []string{"org1", "org2", "org3"}}
+	result := tallyReferendum(rules, 0, choices("org1", "yes", 2), choices("org2", "no", 1), choices("org3", "yes", 1))
+	if result.Outcome != OutcomePassed {
+		t.Errorf("outcome %s with the majority of votes and orgs, expected passed", result.Outcome)
+	}
+	if len(result.Orgs) != 3 || !result.Orgs[0].Passed || result.Orgs[1].Passed || !result.Orgs[2].Passed {
+		t.Errorf("unexpected org results %+v", result.Orgs)
+	}
+	// Two of three orgs but no overall majority.
+	result = tallyReferendum(rules, 0, choices("org1", "yes", 1), choices("org2", "no", 3), choices("org3", "yes", 1))
+	if result.Outcome != OutcomeFailed {
+		t.Errorf("outcome %s without an overall majority, expected failed", result.Outcome)
+	}
+	// The overall majority but only one of three orgs.
+	result = tallyReferendum(rules, 0, choices("org1", "yes", 4), choices("org2", "no", 1), choices("org3", "no", 1))
+	if result.Outcome != OutcomeFailed {
+		t.Errorf("outcome %s with a single org, expected failed", result.Outcome)
+	}
+}
+
+func TestReferendumRulesAreValidated(t *testing.T) {
+	_, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+
+	referendums := map[string]string{
+		`{"threshold":"supermajority"}`:                                            "referendum.majority",
+		`{"threshold":"supermajority","majority":{"numerator":3,"denominator":2}}`: "referendum.majority",
+		`{"threshold":"simple","majority":{"numerator":2,"denominator":3}}`:        "referendum.majority",
+		`{"threshold":"doubleMajority","orgs":["org1"]}`:                           "referendum.orgs",
+		`{"threshold":"simple","quorumPercentage":101}`:                            "referendum.quorumPercentage",
+		`{"threshold":"unanimous"}`:                                                "referendum.threshold",
+	}
+	for referendum, field := range referendums {
+		response := stub.invoke(admin, "initializationInvokation", "e", testElectionJson(10, `"votingMethod":"referendum","referendum":`+referendum+`,"endCondition":{"type":"TimeOnlyCondition"}`))
+		if response.Status == shim.OK {
+			t.Fatalf("%s accepted", referendum)
+		}
+		if fields := violationFields(t, response.Message); strings.Join(fields, ",") != field {
+			t.Errorf("%s: violations of %v, expected %s", referendum, fields, field)
+		}
+	}
+}
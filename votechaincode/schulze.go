@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// SchulzeResult holds every step of a Schulze tally. The rows and columns
+// of both matrices follow Candidates, which is the registry order.
+// Pairwise[i][j] is the weight of the ballots preferring candidate i over j and
+// StrongestPaths[i][j] the strength of the strongest path from i to j.
+// Ranking groups the candidates by the number of candidates they beat, best
+// first; candidates in the same group are tied.
+type SchulzeResult struct {
+	Candidates     []string   `json:"candidates"`
+	Pairwise       [][]int    `json:"pairwise"`
+	StrongestPaths [][]int    `json:"strongestPaths"`
+	Ranking        [][]string `json:"ranking"`
+}
+
+// schulzeMethod lets voters rank candidates and elects the Condorcet
+// winner if there is one, using the Schulze method to resolve cycles.
+// Candidates left out of a ranking are ranked below all ranked candidates
+// and tied among each other.
+type schulzeMethod struct{}
+
+func (schulzeMethod) validateRules(rules *ContestRules, field string, verr *ValidationError) {
+	rejectSelectionLimits(rules, field, verr)
+	rejectSeats(rules, field, verr)
+	rejectWriteIns(rules, field, verr)
+}
+
+func (schulzeMethod) validateBallot(rules *ContestRules, ballot *Ballot) error {
+	err := ballot.expectFields("ranking")
+	if err != nil {
+		return err
+	}
+	return validateRanking(rules, ballot.Ranking)
+}
+
+// counters attributes a ranked ballot to its first preference.
+func (schulzeMethod) counters(ballot *Ballot) *Counters {
+	counters := newCounters()
+	counters.Ballots = 1
+	counters.Candidates[ballot.Ranking[0]] = 1
+	return counters
+}
+
+// tally reports the first preferences as Results and the candidates no one
+// beats as Winners.
+func (schulzeMethod) tally(electionData *ElectionData, rules *ContestRules, ballots []*Ballot, tally *ContestTally) {
+	for _, ballot := range ballots {
+		tally.Results[rules.candidateIndex(ballot.Ranking[0])].Votes += ballot.weight()
+	}
+	result := runSchulze(rules, ballots)
+	tally.Schulze = result
+	if len(ballots) > 0 {
+		tally.Winners = result.Ranking[0]
+	}
+}
+
+// runSchulze computes the pairwise and strongest path matrices and the
+// resulting ranking of the given ranked ballots.
+func runSchulze(rules *ContestRules, ballots []*Ballot) *SchulzeResult {
+	n := len(rules.Candidates)
+	result := &SchulzeResult{
+		Candidates:     []string{},
+		Pairwise:       newMatrix(n),
+		StrongestPaths: newMatrix(n),
+		Ranking:        [][]string{},
+	}
+	for _, candidate := range rules.Candidates {
+		result.Candidates = append(result.Candidates, candidate.ID)
+	}
+
+	d := result.Pairwise
+	for _, ballot := range ballots {
+		// Unranked candidates keep position n, below every ranked one.
+		position := make([]int, n)
+		for i := range position {
+			position[i] = n
+		}
+		for rank, candidateID := range ballot.Ranking {
+			position[rules.candidateIndex(candidateID)] = rank
+		}
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				if position[i] < position[j] {
+					d[i][j] += ballot.weight()
+				}
+			}
+		}
+	}
+
+	p := result.StrongestPaths
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if i != j && d[i][j] > d[j][i] {
+				p[i][j] = d[i][j]
+			}
+		}
+	}
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			if i == k {
+				continue
+			}
+			for j := 0; j < n; j++ {
+				if j == i || j == k {
+					continue
+				}
+				p[i][j] = maxInt(p[i][j], minInt(p[i][k], p[k][j]))
+			}
+		}
+	}
+
+	wins := make([]int, n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if p[i][j] > p[j][i] {
+				wins[i]++
+			}
+		}
+	}
+	for beaten := n - 1; beaten >= 0; beaten-- {
+		var group []string
+		for i, candidateID := range result.Candidates {
+			if wins[i] == beaten {
+				group = append(group, candidateID)
+			}
+		}
+		if len(group) > 0 {
+			result.Ranking = append(result.Ranking, group)
+		}
+	}
+	return result
+}
+
+func newMatrix(n int) [][]int {
+	matrix := make([][]int, n)
+	for i := range matrix {
+		matrix[i] = make([]int, n)
+	}
+	return matrix
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Query the pairwise matrix, strongest paths and ranking of a Schulze
+// contest.
+func (t *VoteChaincode) schulzeQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	tally, err := getContestTally(stub, args, SchulzeMethod)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	resultJson, err := json.Marshal(tally.Schulze)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	return shim.Success(resultJson)
+}
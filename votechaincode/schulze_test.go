@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The 45 voter example of the Wikipedia article on the Schulze method.
+func TestSchulzeWikipediaExample(t *testing.T) {
+	rules := testRules("a", "b", "c", "d", "e")
+	var ballots []*Ballot
+	ballots = append(ballots, rankedBallots(5, "a", "c", "b", "e", "d")...)
+	ballots = append(ballots, rankedBallots(5, "a", "d", "e", "c", "b")...)
+	ballots = append(ballots, rankedBallots(8, "b", "e", "d", "a", "c")...)
+	ballots = append(ballots, rankedBallots(3, "c", "a", "b", "e", "d")...)
+	ballots = append(ballots, rankedBallots(7, "c", "a", "e", "b", "d")...)
+	ballots = append(ballots, rankedBallots(2, "c", "b", "a", "d", "e")...)
+	ballots = append(ballots, rankedBallots(7, "d", "c", "e", "b", "a")...)
+	ballots = append(ballots, rankedBallots(8, "e", "b", "a", "d", "c")...)
+
+	result := runSchulze(rules, ballots)
+
+	pairwise := [][]int{
+		{0, 20, 26, 30, 22},
+		{25, 0, 16, 33, 18},
+		{19, 29, 0, 17, 24},
+		{15, 12, 28, 0, 14},
+		{23, 27, 21, 31, 0},
+	}
+	strongestPaths := [][]int{
+		{0, 28, 28, 30, 24},
+		{25, 0, 28, 33, 24},
+		{25, 29, 0, 29, 24},
+		{25, 28, 28, 0, 24},
+		{25, 28, 28, 31, 0},
+	}
+	ranking := [][]string{{"e"}, {"a"}, {"c"}, {"b"}, {"d"}}
+	if !reflect.DeepEqual(result.Pairwise, pairwise) {
+		t.Errorf("pairwise %v, expected %v", result.Pairwise, pairwise)
+	}
+	if !reflect.DeepEqual(result.StrongestPaths, strongestPaths) {
+		t.Errorf("strongest paths %v, expected %v", result.StrongestPaths, strongestPaths)
+	}
+	if !reflect.DeepEqual(result.Ranking, ranking) {
+		t.Errorf("ranking %v, expected %v", result.Ranking, ranking)
+	}
+}
+
+// Unranked candidates are tied below every ranked one.
+func TestSchulzePartialRankings(t *testing.T) {
+	rules := testRules("a", "b", "c")
+	var ballots []*Ballot
+	ballots = append(ballots, rankedBallots(2, "a")...)
+	ballots = append(ballots, rankedBallots(1, "b", "a")...)
+
+	result := runSchulze(rules, ballots)
+
+	pairwise := [][]int{
+		{0, 2, 3},
+		{1, 0, 1},
+		{0, 0, 0},
+	}
+	ranking := [][]string{{"a"}, {"b"}, {"c"}}
+	if !reflect.DeepEqual(result.Pairwise, pairwise) {
+		t.Errorf("pairwise %v, expected %v", result.Pairwise, pairwise)
+	}
+	if !reflect.DeepEqual(result.Ranking, ranking) {
+		t.Errorf("ranking %v, expected %v", result.Ranking, ranking)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// MaxScore is the highest score a voter can give a candidate.
+const MaxScore = 5
+
+// scoreMethod lets voters rate candidates from 0 to MaxScore. Candidates
+// left out of a ballot count as 0 and the selection limits of the contest
+// apply to the number of rated candidates. The candidates with the highest
+// total score win.
+type scoreMethod struct{}
+
+func (scoreMethod) validateRules(rules *ContestRules, field string, verr *ValidationError) {
+	validateSelectionLimits(rules, field, verr)
+	rejectSeats(rules, field, verr)
+	rejectWriteIns(rules, field, verr)
+}
+
+func (scoreMethod) validateBallot(rules *ContestRules, ballot *Ballot) error {
+	err := ballot.expectFields("scores")
+	if err != nil {
+		return err
+	}
+	// Sorted so that every peer reports the same error.
+	candidateIDs := make([]string, 0, len(ballot.Scores))
+	for candidateID := range ballot.Scores {
+		candidateIDs = append(candidateIDs, candidateID)
+	}
+	sort.Strings(candidateIDs)
+	for _, candidateID := range candidateIDs {
+		score := ballot.Scores[candidateID]
+		if rules.candidateIndex(candidateID) == -1 {
+			return errors.New("unknown candidate \"" + candidateID + "\" in scores")
+		}
+		if score < 0 || score > MaxScore {
+			return errors.New("score of candidate \"" + candidateID + "\" must be between 0 and " + strconv.Itoa(MaxScore))
+		}
+	}
+	return checkSelections(rules, len(ballot.Scores))
+}
+
+// counters counts every candidate rated above 0.
+func (scoreMethod) counters(ballot *Ballot) *Counters {
+	counters := newCounters()
+	counters.Ballots = 1
+	for candidateID, score := range ballot.Scores {
+		if score > 0 {
+			counters.Candidates[candidateID] = 1
+		}
+	}
+	return counters
+}
+
+func (scoreMethod) tally(electionData *ElectionData, rules *ContestRules, ballots []*Ballot, tally *ContestTally) {
+	totals := newTotals(rules)
+	for _, ballot := range ballots {
+		for candidateID, score := range ballot.Scores {
+			index := rules.candidateIndex(candidateID)
+			totals[index].Marks += ballot.weight()
+			totals[index].Total += score * ballot.weight()
+		}
+	}
+	finishTotals(totals, totalWeight(ballots), tally)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScoreVoting(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	voter := newVoter(t, "voter")
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, `"votingMethod":"score","maxSelections":2,`+
+		`"candidates":[{"id":"a","name":"A"},{"id":"b","name":"B"},{"id":"c","name":"C"}],"endCondition":{"type":"TimeOnlyCondition"}`))
+	ballots := map[string]string{
+		`{"scores":{"a":6}}`:             `score of candidate "a" must be between 0 and 5`,
+		`{"scores":{"a":-1}}`:            `score of candidate "a" must be between 0 and 5`,
+		`{"scores":{"d":1}}`:             `unknown candidate "d" in scores`,
+		`{"scores":{"a":1,"b":1,"c":1}}`: "at most 2 candidates may be selected",
+		`{"approvals":["a"]}`:            "approvals not allowed, expecting scores",
+	}
+	for ballot, message := range ballots {
+		stub.expectError(t, message, voter, "voteInvokation", "e", ballot)
+	}
+	castBallots(t, stub, "e", `{"scores":{"a":5,"b":3}}`, `{"scores":{"a":1,"c":4}}`, `{"scores":{"b":0}}`)
+	setClock(frozen, testEndDate+1)
+
+	// Averages count the ballots that leave a candidate out as 0.
+	tally := queryTally(t, stub, admin, "e")
+	expected := []CandidateTotal{{"a", 2, 6, 2}, {"b", 2, 3, 1}, {"c", 1, 4, 4.0 / 3}}
+	if !reflect.DeepEqual(tally.Totals, expected) {
+		t.Errorf("totals %+v, expected %+v", tally.Totals, expected)
+	}
+	if !reflect.DeepEqual(tally.Winners, []string{"a"}) || tally.Results[0].Votes != 6 {
+		t.Errorf("winners %v with results %+v, expected a with 6", tally.Winners, tally.Results)
+	}
+}
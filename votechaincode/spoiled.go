@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const spoiledObjectType = "spoiled"
+
+// SpoiledBallot marks the ballot of a voter as spoiled. The ballot itself
+// stays on the ledger unchanged but isn't counted by the tally. Reason is a
+// short code like "coerced" or "identifiable".
+type SpoiledBallot struct {
+	VoterID   string `json:"voterID"`
+	Reason    string `json:"reason"`
+	SpoiledBy string `json:"spoiledBy"`
+	SpoiledAt int64  `json:"spoiledAt"`
+	TxID      string `json:"txID"`
+}
+
+func spoiledKey(stub shim.ChaincodeStubInterface, electionID, voterID string) (string, error) {
+	return stub.CreateCompositeKey(spoiledObjectType, []string{electionID, voterID})
+}
+
+// getSpoiledBallots returns the spoiled ballots of an election in key order
+// and the keys they are stored under.
+func getSpoiledBallots(stub shim.ChaincodeStubInterface, electionID string) ([]SpoiledBallot, []string, error) {
+	stateIterator, err := stub.GetStateByPartialCompositeKey(spoiledObjectType, []string{electionID})
+	if err != nil {
+		return nil, nil, errors.New("Failed to get StateIterator")
+	}
+	defer stateIterator.Close()
+
+	spoiled := []SpoiledBallot{}
+	var keys []string
+	for stateIterator.HasNext() {
+		queryResponse, err := stateIterator.Next()
+		if err != nil {
+			return nil, nil, errors.New("StateIterator failed to retrieve next Element")
+		}
+		var record SpoiledBallot
+		err = json.Unmarshal(queryResponse.Value, &record)
+		if err != nil {
+			return nil, nil, errors.New("Stored spoiled ballot couldn't be parsed")
+		}
+		spoiled = append(spoiled, record)
+		keys = append(keys, queryResponse.Key)
+	}
+	return spoiled, keys, nil
+}
+
+// spoiledVoteKeys returns the set of vote keys of the spoiled ballots of an
+// election.
+func spoiledVoteKeys(stub shim.ChaincodeStubInterface, electionID string) (map[string]bool, error) {
+	spoiled, _, err := getSpoiledBallots(stub, electionID)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]bool)
+	for _, record := range spoiled {
+		key, err := voteKey(stub, electionID, record.VoterID)
+		if err != nil {
+			return nil, err
+		}
+		keys[key] = true
+	}
+	return keys, nil
+}
+
+// deleteSpoiledBallots removes the spoiled markers of an election.
+func deleteSpoiledBallots(stub shim.ChaincodeStubInterface, electionID string) error {
+	_, keys, err := getSpoiledBallots(stub, electionID)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = stub.DelState(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Mark the ballot of a voter as spoiled. Expects the election ID, the voter
+// ID as listed by allVotesQuery and a reason code. Ballots can be spoiled
+// until the election is tallied.
+func (t *VoteChaincode) spoilBallot(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err := cid.AssertAttributeValue(stub, "admin", "true")
+	if err != nil {
+		return shim.Error("User isn't admin")
+	}
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID, the voter ID and a reason code")
+	}
+	electionID, voterID, reason := args[0], args[1], args[2]
+	err = validateID("Reason code", reason)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	electionData, lifecycle, err := getElection(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !lifecycle.hasStarted() || lifecycle.State == StateTallied || lifecycle.State == StateCertified || lifecycle.State == StateArchived {
+		return shim.Error("Ballots can only be spoiled between the start and the tally of an election")
+	}
+
+	ballotKey, err := voteKey(stub, electionID, voterID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ballotBytes, err := stub.GetState(ballotKey)
+	if err != nil {
+		return shim.Error("Failed to get state")
+	}
+	if ballotBytes == nil {
+		return shim.Error("No ballot of voter " + voterID)
+	}
+	ballotBytes, err = readBallot(stub, electionData, ballotKey, ballotBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := spoiledKey(stub, electionID, voterID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stateBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error("Failed to get state")
+	}
+	if stateBytes != nil {
+		return shim.Error("Ballot already spoiled")
+	}
+
+	adminID, err := cid.GetID(stub)
+	if err != nil {
+		return shim.Error("Couldn't read ID from stub.")
+	}
+	now, err := nowUnix(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	record := SpoiledBallot{
+		VoterID:   voterID,
+		Reason:    reason,
+		SpoiledBy: adminID,
+		SpoiledAt: now,
+		TxID:      stub.GetTxID(),
+	}
+	recordJson, err := json.Marshal(record)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	err = stub.PutState(key, recordJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Take the ballot out of the counters again, unless it couldn't be
+	// parsed and never added anything.
+	delta := newCounters()
+	var ballot Ballot
+	if json.Unmarshal(ballotBytes, &ballot) == nil && electionData.validateBallot(&ballot) == nil {
+		counters, err := ballotCounters(electionData, &ballot)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		for candidateID, votes := range counters.Candidates {
+			delta.Candidates[candidateID] = -votes
+		}
+		delta.Blank = -counters.Blank
+
+		if electionData.Encryption != nil {
+			err = unspoilEncryptedTally(stub, electionID, electionData, &ballot)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+	}
+	delta.Spoiled = 1
+	err = putCounterDelta(stub, electionID, delta)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = stub.SetEvent("BallotSpoiled", recordJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("Ballot of " + voterID + " in election " + electionID + " spoiled: " + reason)
+	return shim.Success(recordJson)
+}
+
+// Query the spoiled ballots of an election. Visible like the ballots
+// themselves.
+func (t *VoteChaincode) spoiledBallotsQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID")
+	}
+	electionData, lifecycle, err := getElection(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = assertResultsVisible(stub, electionData, lifecycle)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	spoiled, _, err := getSpoiledBallots(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	spoiledJson, err := json.Marshal(spoiled)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	return shim.Success(spoiledJson)
+}
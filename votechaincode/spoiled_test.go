@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestBlankAndSpoiledBallots(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	coerced := newVoter(t, "coerced")
+
+	// Only valid ballots count for the end condition, blank and spoiled
+	// ones don't.
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, `"candidates":[{"id":"a","name":"A"},{"id":"b","name":"B"}],`+
+		`"endCondition":{"type":"VoteCountCondition","count":3,"ballots":"valid"}`))
+	stub.expectError(t, "Invalid ballot: candidate not allowed, expecting blank", coerced, "voteInvokation", "e", `{"candidate":"a","blank":true}`)
+	stub.mustInvoke(t, coerced, "voteInvokation", "e", `{"candidate":"a"}`)
+	castBallots(t, stub, "e", `{"blank":true}`, `{"candidate":"b"}`)
+
+	stub.expectError(t, "User isn't admin", coerced, "spoilBallot", "e", coerced.ID, "coerced")
+	stub.expectError(t, "Reason code may only contain letters", admin, "spoilBallot", "e", coerced.ID, "coerced!")
+	stub.expectError(t, "No ballot of voter unknown", admin, "spoilBallot", "e", "unknown", "coerced")
+	stub.mustInvoke(t, admin, "spoilBallot", "e", coerced.ID, "coerced")
+	stub.expectError(t, "Ballot already spoiled", admin, "spoilBallot", "e", coerced.ID, "coerced")
+
+	var turnout Turnout
+	err := json.Unmarshal(stub.mustInvoke(t, coerced, "turnoutQuery", "e"), &turnout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if turnout.TotalBallots != 3 || turnout.SpoiledBallots != 1 {
+		t.Errorf("unexpected turnout %+v", turnout)
+	}
+
+	castBallots(t, stub, "e", `{"candidate":"a"}`)
+	if state := electionState(t, stub, "e"); state != StateOpen {
+		t.Fatalf("state %s with two valid ballots, expected Open", state)
+	}
+	castBallots(t, stub, "e", `{"candidate":"b"}`)
+	if state := electionState(t, stub, "e"); state != StateClosed {
+		t.Fatalf("state %s with three valid ballots, expected Closed", state)
+	}
+
+	tally := queryTally(t, stub, coerced, "e")
+	if tally.TotalBallots != 5 || tally.ValidBallots != 3 || tally.BlankBallots != 1 || tally.SpoiledBallots != 1 || tally.InvalidBallots != 0 {
+		t.Errorf("unexpected totals %+v", tally)
+	}
+	if tally.Valid != 3 || tally.Blank != 1 || !reflect.DeepEqual(tally.Results, []CandidateResult{{"a", "A", 1}, {"b", "B", 2}}) {
+		t.Errorf("unexpected results %+v, expected the spoiled vote for a not to count", tally.ContestTally)
+	}
+
+	var spoiled []SpoiledBallot
+	err = json.Unmarshal(stub.mustInvoke(t, coerced, "spoiledBallotsQuery", "e"), &spoiled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spoiled) != 1 || spoiled[0].VoterID != coerced.ID || spoiled[0].Reason != "coerced" || spoiled[0].SpoiledBy != admin.ID {
+		t.Errorf("unexpected spoiled ballots %+v", spoiled)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// stvScale is the fixed point precision of STV vote values. A ballot is
+// worth its weight times stvScale units and transfer values are truncated to five decimals,
+// so every peer computes exactly the same result.
+const stvScale = 100000
+
+// STV stage actions.
+const (
+	stvFirstPreferences = "firstPreferences"
+	stvSurplus          = "surplus"
+	stvExclusion        = "exclusion"
+)
+
+// STVResult is the stage by stage report of a single transferable vote
+// tally. Elected lists the elected candidates in the order they were
+// elected.
+type STVResult struct {
+	Seats   int        `json:"seats"`
+	Quota   float64    `json:"quota"`
+	Stages  []STVStage `json:"stages"`
+	Elected []string   `json:"elected"`
+}
+
+// STVStage is one stage of an STV count. Except for the first preferences,
+// every stage transfers the surplus of an elected candidate or the ballots
+// of an excluded one, given by CandidateID. Transfers is the value every
+// candidate received, Exhausted the value of ballots without a further
+// preference and LostToRounding the value lost by truncating transfer
+// values. Totals are the values of all candidates not excluded after the
+// transfer. Elected lists the candidates that reached the quota in this
+// stage, or that were elected because only as many continuing candidates as
+// open seats were left.
+type STVStage struct {
+	Stage          int              `json:"stage"`
+	Action         string           `json:"action"`
+	CandidateID    string           `json:"candidateID,omitempty"`
+	TieBreak       string           `json:"tieBreak,omitempty"`
+	TransferValue  float64          `json:"transferValue,omitempty"`
+	Transfers      []CandidateValue `json:"transfers,omitempty"`
+	Exhausted      float64          `json:"exhausted"`
+	LostToRounding float64          `json:"lostToRounding,omitempty"`
+	Totals         []CandidateValue `json:"totals"`
+	Elected        []string         `json:"elected,omitempty"`
+}
+
+// CandidateValue is a possibly fractional number of votes of a candidate.
+type CandidateValue struct {
+	CandidateID string  `json:"candidateID"`
+	Value       float64 `json:"value"`
+}
+
+// stvMethod fills the seats of a contest by single transferable vote with
+// the Droop quota. Surpluses are transferred with the weighted inclusive
+// Gregory method: all ballots of an elected candidate move on at a value
+// reduced by surplus / total. If no candidate reaches the quota the one with
+// the fewest votes is excluded and its ballots move on at their value.
+type stvMethod struct{}
+
+func (stvMethod) validateRules(rules *ContestRules, field string, verr *ValidationError) {
+	rejectSelectionLimits(rules, field, verr)
+	rejectWriteIns(rules, field, verr)
+}
+
+func (stvMethod) validateBallot(rules *ContestRules, ballot *Ballot) error {
+	err := ballot.expectFields("ranking")
+	if err != nil {
+		return err
+	}
+	return validateRanking(rules, ballot.Ranking)
+}
+
+// counters attributes a ranked ballot to its first preference.
+func (stvMethod) counters(ballot *Ballot) *Counters {
+	counters := newCounters()
+	counters.Ballots = 1
+	counters.Candidates[ballot.Ranking[0]] = 1
+	return counters
+}
+
+// tally reports the first preferences as Results and the elected candidates
+// as Winners.
+func (stvMethod) tally(electionData *ElectionData, rules *ContestRules, ballots []*Ballot, tally *ContestTally) {
+	for _, ballot := range ballots {
+		tally.Results[rules.candidateIndex(ballot.Ranking[0])].Votes += ballot.weight()
+	}
+	result := runSTV(rules, ballots)
+	tally.STV = result
+	elected := make(map[string]bool)
+	for _, candidateID := range result.Elected {
+		elected[candidateID] = true
+	}
+	for _, candidate := range rules.Candidates {
+		if elected[candidate.ID] {
+			tally.Winners = append(tally.Winners, candidate.ID)
+		}
+	}
+}
+
+// runSTV counts the given ranked ballots stage by stage until every seat is
+// filled.
+func runSTV(rules *ContestRules, ballots []*Ballot) *STVResult {
+	seats := rules.seats()
+	quota := (totalWeight(ballots)/(seats+1) + 1) * stvScale
+	result := &STVResult{
+		Seats:   seats,
+		Quota:   stvValue(quota),
+		Stages:  []STVStage{},
+		Elected: []string{},
+	}
+	if len(ballots) == 0 {
+		return result
+	}
+
+	continuing := make(map[string]bool)
+	for _, candidate := range rules.Candidates {
+		continuing[candidate.ID] = true
+	}
+	excluded := make(map[string]bool)
+	totals := make(map[string]int)
+	weights := make([]int, len(ballots))
+	holders := make([]string, len(ballots))
+
+	stage := STVStage{Action: stvFirstPreferences}
+	exhausted := 0
+	for i, ballot := range ballots {
+		weights[i] = ballot.weight() * stvScale
+		holders[i] = nextPreference(ballot.Ranking, continuing)
+		totals[holders[i]] += weights[i]
+	}
+
+	// pending are elected candidates whose surplus wasn't transferred yet.
+	var pending []string
+	var history []map[string]int
+	for {
+		stage.Stage = len(result.Stages) + 1
+		stage.Exhausted = stvValue(exhausted)
+		for _, candidateID := range stvElect(rules, continuing, totals, quota, seats-len(result.Elected)) {
+			delete(continuing, candidateID)
+			result.Elected = append(result.Elected, candidateID)
+			pending = append(pending, candidateID)
+			stage.Elected = append(stage.Elected, candidateID)
+		}
+		stageTotals := make(map[string]int)
+		for _, candidate := range rules.Candidates {
+			if !excluded[candidate.ID] {
+				stage.Totals = append(stage.Totals, CandidateValue{CandidateID: candidate.ID, Value: stvValue(totals[candidate.ID])})
+				stageTotals[candidate.ID] = totals[candidate.ID]
+			}
+		}
+		history = append(history, stageTotals)
+		result.Stages = append(result.Stages, stage)
+		if len(result.Elected) >= seats || len(continuing) == 0 {
+			return result
+		}
+
+		stage = STVStage{}
+		transfers := make(map[string]int)
+		exhausted = 0
+		lost := 0
+		var moving string
+		transferValue := 0
+		for len(pending) > 0 && moving == "" {
+			largest := 0
+			for i, candidateID := range pending {
+				if totals[candidateID] > totals[pending[largest]] {
+					largest = i
+				}
+			}
+			candidateID := pending[largest]
+			pending = append(pending[:largest], pending[largest+1:]...)
+			if totals[candidateID] > quota {
+				moving = candidateID
+				lost = totals[candidateID] - quota
+				transferValue = lost * stvScale / totals[candidateID]
+			}
+		}
+		if moving != "" {
+			stage.Action = stvSurplus
+			stage.TransferValue = stvValue(transferValue)
+			totals[moving] = quota
+		} else {
+			var counts []CandidateCount
+			for _, candidate := range rules.Candidates {
+				if continuing[candidate.ID] {
+					counts = append(counts, CandidateCount{CandidateID: candidate.ID, Votes: totals[candidate.ID]})
+				}
+			}
+			moving, stage.TieBreak = lowestCandidate(counts, history, "stage")
+			stage.Action = stvExclusion
+			delete(continuing, moving)
+			excluded[moving] = true
+			totals[moving] = 0
+		}
+		stage.CandidateID = moving
+
+		for i, ballot := range ballots {
+			if holders[i] != moving {
+				continue
+			}
+			if stage.Action == stvSurplus {
+				weights[i] = weights[i] * transferValue / stvScale
+			}
+			holders[i] = nextPreference(ballot.Ranking, continuing)
+			if holders[i] == "" {
+				exhausted += weights[i]
+			} else {
+				transfers[holders[i]] += weights[i]
+				totals[holders[i]] += weights[i]
+			}
+			if stage.Action == stvSurplus {
+				lost -= weights[i]
+			}
+		}
+		for _, candidate := range rules.Candidates {
+			if transfers[candidate.ID] > 0 {
+				stage.Transfers = append(stage.Transfers, CandidateValue{CandidateID: candidate.ID, Value: stvValue(transfers[candidate.ID])})
+			}
+		}
+		stage.LostToRounding = stvValue(lost)
+	}
+}
+
+// stvElect returns the continuing candidates elected in the current stage,
+// most votes first and ties in registry order. Those are the candidates that
+// reached the quota or, if no more continuing candidates than open seats
+// are left, all of them.
+func stvElect(rules *ContestRules, continuing map[string]bool, totals map[string]int, quota, openSeats int) []string {
+	var elected []string
+	for _, candidate := range rules.Candidates {
+		if continuing[candidate.ID] && (totals[candidate.ID] >= quota || len(continuing) <= openSeats) {
+			elected = append(elected, candidate.ID)
+		}
+	}
+	sort.SliceStable(elected, func(i, j int) bool {
+		return totals[elected[i]] > totals[elected[j]]
+	})
+	if len(elected) > openSeats {
+		elected = elected[:openSeats]
+	}
+	return elected
+}
+
+// stvValue converts a fixed point STV value to votes.
+func stvValue(value int) float64 {
+	return float64(value) / stvScale
+}
+
+// Query the stage by stage report of an STV contest.
+func (t *VoteChaincode) stvQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	tally, err := getContestTally(stub, args, STVMethod)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	resultJson, err := json.Marshal(tally.STV)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	return shim.Success(resultJson)
+}
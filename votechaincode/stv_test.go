@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The food election of the Wikipedia article on single transferable vote:
+// 20 voters fill 3 seats with a Droop quota of 6.
+func TestSTVWikipediaFoodElection(t *testing.T) {
+	rules := testRules("orange", "pear", "chocolate", "strawberry", "hamburger")
+	rules.Seats = 3
+	var ballots []*Ballot
+	ballots = append(ballots, rankedBallots(4, "orange")...)
+	ballots = append(ballots, rankedBallots(2, "pear", "orange")...)
+	ballots = append(ballots, rankedBallots(8, "chocolate", "strawberry")...)
+	ballots = append(ballots, rankedBallots(4, "chocolate", "hamburger")...)
+	ballots = append(ballots, rankedBallots(1, "strawberry")...)
+	ballots = append(ballots, rankedBallots(1, "hamburger")...)
+
+	result := runSTV(rules, ballots)
+
+	if result.Quota != 6 {
+		t.Errorf("quota %v, expected 6", result.Quota)
+	}
+	elected := []string{"chocolate", "orange", "strawberry"}
+	if !reflect.DeepEqual(result.Elected, elected) {
+		t.Errorf("elected %v, expected %v", result.Elected, elected)
+	}
+
+	stages := []STVStage{
+		{
+			Stage:   1,
+			Action:  stvFirstPreferences,
+			Totals:  []CandidateValue{{"orange", 4}, {"pear", 2}, {"chocolate", 12}, {"strawberry", 1}, {"hamburger", 1}},
+			Elected: []string{"chocolate"},
+		},
+		{
+			Stage:         2,
+			Action:        stvSurplus,
+			CandidateID:   "chocolate",
+			TransferValue: 0.5,
+			Transfers:     []CandidateValue{{"strawberry", 4}, {"hamburger", 2}},
+			Totals:        []CandidateValue{{"orange", 4}, {"pear", 2}, {"chocolate", 6}, {"strawberry", 5}, {"hamburger", 3}},
+		},
+		{
+			Stage:       3,
+			Action:      stvExclusion,
+			CandidateID: "pear",
+			Transfers:   []CandidateValue{{"orange", 2}},
+			Totals:      []CandidateValue{{"orange", 6}, {"chocolate", 6}, {"strawberry", 5}, {"hamburger", 3}},
+			Elected:     []string{"orange"},
+		},
+		{
+			Stage:       4,
+			Action:      stvExclusion,
+			CandidateID: "hamburger",
+			Exhausted:   3,
+			Totals:      []CandidateValue{{"orange", 6}, {"chocolate", 6}, {"strawberry", 5}},
+			Elected:     []string{"strawberry"},
+		},
+	}
+	if len(result.Stages) != len(stages) {
+		t.Fatalf("%d stages, expected %d: %+v", len(result.Stages), len(stages), result.Stages)
+	}
+	for i, expected := range stages {
+		if !reflect.DeepEqual(result.Stages[i], expected) {
+			t.Errorf("stage %d: %+v, expected %+v", i+1, result.Stages[i], expected)
+		}
+	}
+}
+
+// Transfer values are truncated to five decimals and the value this drops
+// is reported as lost to rounding.
+func TestSTVRounding(t *testing.T) {
+	rules := testRules("a", "b", "c")
+	rules.Seats = 2
+	var ballots []*Ballot
+	ballots = append(ballots, rankedBallots(3, "a", "b")...)
+	ballots = append(ballots, rankedBallots(1, "c")...)
+
+	result := runSTV(rules, ballots)
+
+	// The quota is 2, a's surplus of 1 moves on at 1/3.
+	surplus := result.Stages[1]
+	if surplus.Action != stvSurplus || surplus.TransferValue != 0.33333 || surplus.LostToRounding != 0.00001 {
+		t.Errorf("unexpected surplus stage %+v", surplus)
+	}
+	if !reflect.DeepEqual(surplus.Transfers, []CandidateValue{{"b", 0.99999}}) {
+		t.Errorf("transfers %v, expected [{b 0.99999}]", surplus.Transfers)
+	}
+	if !reflect.DeepEqual(result.Elected, []string{"a", "c"}) {
+		t.Errorf("elected %v, expected [a c]", result.Elected)
+	}
+}
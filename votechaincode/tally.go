@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Tally is the canonical result of an election. The result of an election
+// without contests is inlined through the embedded ContestTally, elections
+// with contests list one ContestTally per contest in Contests instead.
+// TotalBallots are all cast ballots. Of those, SpoiledBallots were spoiled by
+// an admin, InvalidBallots couldn't be counted, BlankBallots answer every
+// contest blank and ValidBallots are the rest. UnrevealedBallots are the
+// commitments of a commit–reveal election whose ballot was never revealed,
+// they aren't part of TotalBallots but count for the turnout.
+type Tally struct {
+	ElectionID        string  `json:"electionID"`
+	TotalBallots      int     `json:"totalBallots"`
+	ValidBallots      int     `json:"validBallots"`
+	BlankBallots      int     `json:"blankBallots"`
+	SpoiledBallots    int     `json:"spoiledBallots"`
+	InvalidBallots    int     `json:"invalidBallots"`
+	UnrevealedBallots int     `json:"unrevealedBallots,omitempty"`
+	VoterCount        int     `json:"voterCount"`
+	Turnout           float64 `json:"turnout"`
+	// TotalWeight is the weight of the valid ballots of a weighted
+	// election.
+	TotalWeight int `json:"totalWeight,omitempty"`
+	// Undecrypted is set for encrypted elections whose tally the trustees
+	// haven't decrypted yet. No candidate has votes then.
+	Undecrypted bool `json:"undecrypted,omitempty"`
+	*ContestTally
+	Contests []ContestTally `json:"contests,omitempty"`
+}
+
+// ContestTally is the result of a single contest. Results are listed in the
+// order of the candidate registry and Winners in the same order, so the
+// marshalled Tally is identical on every peer. Valid is the weight of the
+// answers to the contest that aren't blank and Blank that of the blank ones.
+type ContestTally struct {
+	ContestID string            `json:"contestID,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Valid     int               `json:"valid"`
+	Blank     int               `json:"blank"`
+	Results   []CandidateResult `json:"results"`
+	Winners   []string          `json:"winners"`
+
+	// Details of the votingMethod, only one of them is set.
+	InstantRunoff *InstantRunoffResult `json:"instantRunoff,omitempty"`
+	Totals        []CandidateTotal     `json:"totals,omitempty"`
+	Schulze       *SchulzeResult       `json:"schulze,omitempty"`
+	STV           *STVResult           `json:"stv,omitempty"`
+	Referendum    *ReferendumResult    `json:"referendum,omitempty"`
+
+	// WriteIns counts the write-ins of contests with write-in slots. Mapped
+	// write-ins are part of Results.
+	WriteIns []WriteInCount `json:"writeIns,omitempty"`
+}
+
+// CandidateResult is the number of votes a single candidate received.
+type CandidateResult struct {
+	CandidateID string `json:"candidateID"`
+	Name        string `json:"name"`
+	Votes       int    `json:"votes"`
+}
+
+// CandidateTotal is the approval or score total of a candidate. Marks is
+// the weight of the ballots that approved or scored the candidate and
+// Average is Total divided by the weight of all valid ballots, counting
+// ballots that don't mark the candidate as 0.
+type CandidateTotal struct {
+	CandidateID string  `json:"candidateID"`
+	Marks       int     `json:"marks"`
+	Total       int     `json:"total"`
+	Average     float64 `json:"average"`
+}
+
+// Turnout is the result of turnoutQuery. It reveals how many voters took
+// part and how many ballots were spoiled but nothing about their choices,
+// so blank ballots aren't reported until the tally.
+type Turnout struct {
+	ElectionID     string  `json:"electionID"`
+	TotalBallots   int     `json:"totalBallots"`
+	SpoiledBallots int     `json:"spoiledBallots"`
+	VoterCount     int     `json:"voterCount"`
+	Turnout        float64 `json:"turnout"`
+}
+
+// assertResultsVisible returns an error if the caller may not see ballots
+// or results yet. Until voting and the reveal period of a commit–reveal
+// election are over only identities with the auditor attribute get to see
+// them.
+func assertResultsVisible(stub shim.ChaincodeStubInterface, electionData *ElectionData, lifecycle *Lifecycle) error {
+	if !lifecycle.hasStarted() {
+		return errors.New("Election hasn't started yet")
+	}
+	message := "Results are hidden until the election has closed"
+	if lifecycle.hasEnded() {
+		if assertRevealOver(stub, electionData, lifecycle) == nil {
+			return nil
+		}
+		message = "Results are hidden until the reveal period is over"
+	}
+	err := cid.AssertAttributeValue(stub, "auditor", "true")
+	if err != nil {
+		return errors.New(message)
+	}
+	return nil
+}
+
+// forEachBallot calls fn with the key and stored ballot of every ballot of
+// an election.
+func forEachBallot(stub shim.ChaincodeStubInterface, electionID string, electionData *ElectionData, fn func(key string, value []byte) error) error {
+	stateIterator, err := votesIterator(stub, electionID)
+	if err != nil {
+		return errors.New("Failed to get StateIterator")
+	}
+	defer stateIterator.Close()
+
+	for stateIterator.HasNext() {
+		queryResponse, err := stateIterator.Next()
+		if err != nil {
+			return errors.New("StateIterator failed to retrieve next Element")
+		}
+		value, err := readBallot(stub, electionData, queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return err
+		}
+		err = fn(queryResponse.Key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// computeTally counts the ballots of an election, every contest with its
+// own voting method. Spoiled ballots aren't counted and blank answers only
+// count towards the Blank of their contest. Write-ins count for the
+// candidates they are mapped to.
+func computeTally(stub shim.ChaincodeStubInterface, electionID string, electionData *ElectionData) (*Tally, error) {
+	tally := &Tally{
+		ElectionID: electionID,
+		VoterCount: electionData.VoterCount,
+	}
+	contests := electionData.contests()
+	spoiled, err := spoiledVoteKeys(stub, electionID)
+	if err != nil {
+		return nil, err
+	}
+	var decrypted *DecryptedTally
+	if electionData.Encryption != nil {
+		decrypted, err = getDecryptedTally(stub, electionID)
+		if err != nil {
+			return nil, err
+		}
+		tally.Undecrypted = decrypted == nil
+	}
+
+	// answers[i] are the non-blank answers of the counted ballots to
+	// contests[i] and blank[i] the weight of the blank ones.
+	answers := make([][]*Ballot, len(contests))
+	blank := make([]int, len(contests))
+	voteKeys := make(map[string]bool)
+	err = forEachBallot(stub, electionID, electionData, func(key string, value []byte) error {
+		tally.TotalBallots++
+		voteKeys[key] = true
+		if spoiled[key] {
+			tally.SpoiledBallots++
+			return nil
+		}
+		var ballot Ballot
+		err := json.Unmarshal(value, &ballot)
+		if err != nil || electionData.validateBallot(&ballot) != nil {
+			tally.InvalidBallots++
+			return nil
+		}
+		if ballot.isBlank(electionData) {
+			tally.BlankBallots++
+		} else {
+			tally.ValidBallots++
+		}
+		if electionData.Weights != nil {
+			tally.TotalWeight += ballot.weight()
+		}
+		for i, contest := range contests {
+			answer := ballot.answer(contest)
+			if answer.Blank {
+				blank[i] += answer.weight()
+			} else {
+				answers[i] = append(answers[i], answer)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	participants := tally.TotalBallots
+	if electionData.CommitReveal != nil {
+		unrevealed, err := unrevealedCommitments(stub, electionID, voteKeys)
+		if err != nil {
+			return nil, err
+		}
+		tally.UnrevealedBallots = len(unrevealed)
+		participants += tally.UnrevealedBallots
+	}
+	tally.Turnout = float64(participants) / float64(tally.VoterCount) * 100
+
+	for i, contest := range contests {
+		method, err := contest.votingMethod()
+		if err != nil {
+			return nil, err
+		}
+		contestTally := &ContestTally{
+			ContestID: contest.ID,
+			Title:     contest.Title,
+			Valid:     totalWeight(answers[i]),
+			Blank:     blank[i],
+			Results:   []CandidateResult{},
+			Winners:   []string{},
+		}
+		rules := &contest.ContestRules
+		if rules.WriteIns > 0 {
+			mapping, err := getWriteInMapping(stub, electionID, contest.ID)
+			if err != nil {
+				return nil, err
+			}
+			rules, answers[i], contestTally.WriteIns = resolveWriteIns(rules, mapping, answers[i])
+		}
+		for _, candidate := range rules.Candidates {
+			contestTally.Results = append(contestTally.Results, CandidateResult{CandidateID: candidate.ID, Name: candidate.Name})
+		}
+		if electionData.Encryption != nil {
+			tallyDecrypted(contest, decrypted, contestTally)
+		} else {
+			method.tally(electionData, rules, answers[i], contestTally)
+		}
+		if contest.ID == "" {
+			tally.ContestTally = contestTally
+		} else {
+			tally.Contests = append(tally.Contests, *contestTally)
+		}
+	}
+	return tally, nil
+}
+
+// getContestTally computes the tally of a contest for the queries of method
+// specific details. args are the election ID and, for elections with
+// contests, the contest ID.
+func getContestTally(stub shim.ChaincodeStubInterface, args []string, votingMethod string) (*ContestTally, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting the election ID and optionally the contest ID")
+	}
+	electionData, lifecycle, err := getElection(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	contestID := ""
+	if len(args) == 2 {
+		contestID = args[1]
+	}
+	contest, err := electionData.contest(contestID)
+	if err != nil {
+		return nil, err
+	}
+	if contest.VotingMethod != votingMethod {
+		return nil, errors.New("Contest doesn't use votingMethod \"" + votingMethod + "\"")
+	}
+	err = assertResultsVisible(stub, electionData, lifecycle)
+	if err != nil {
+		return nil, err
+	}
+
+	tally, err := computeTally(stub, args[0], electionData)
+	if err != nil {
+		return nil, err
+	}
+	if contestID == "" {
+		return tally.ContestTally, nil
+	}
+	return &tally.Contests[electionData.contestIndex(contestID)], nil
+}
+
+// Query the per candidate result of an election. Several winners mean a tie.
+func (t *VoteChaincode) tallyQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID")
+	}
+	electionData, lifecycle, err := getElection(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = assertResultsVisible(stub, electionData, lifecycle)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	tally, err := computeTally(stub, args[0], electionData)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	tallyJson, err := json.Marshal(tally)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	return shim.Success(tallyJson)
+}
+
+// Query how many ballots were cast so far. Available while voting is open.
+func (t *VoteChaincode) turnoutQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID")
+	}
+	electionData, lifecycle, err := getElection(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !lifecycle.hasStarted() {
+		return shim.Error("Election hasn't started yet")
+	}
+
+	counters, _, err := getCounters(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	turnout := Turnout{ElectionID: args[0], TotalBallots: counters.Ballots, SpoiledBallots: counters.Spoiled, VoterCount: electionData.VoterCount}
+	turnout.Turnout = float64(turnout.TotalBallots) / float64(turnout.VoterCount) * 100
+
+	turnoutJson, err := json.Marshal(turnout)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	return shim.Success(turnoutJson)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// queryTally returns the tallyQuery result of an election for identity.
+func queryTally(t *testing.T, stub *testStub, identity testIdentity, electionID string) *Tally {
+	t.Helper()
+	var tally Tally
+	err := json.Unmarshal(stub.mustInvoke(t, identity, "tallyQuery", electionID), &tally)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tally
+}
+
+// castBallots casts every ballot in ballots with a new voter.
+func castBallots(t *testing.T, stub *testStub, electionID string, ballots ...string) {
+	t.Helper()
+	for _, ballot := range ballots {
+		// testSerial makes the name unique.
+		stub.mustInvoke(t, newVoter(t, "cast"+strconv.FormatInt(testSerial, 10)), "voteInvokation", electionID, ballot)
+	}
+}
+
+func TestTallyQueryCountsBallots(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, `"candidates":[{"id":"c","name":"C"},{"id":"a","name":"A"},{"id":"b","name":"B"}],"endCondition":{"type":"TimeOnlyCondition"}`))
+	castBallots(t, stub, "e", `{"candidate":"a"}`, `{"candidate":"b"}`, `{"candidate":"a"}`, `{"candidate":"c"}`, `{"candidate":"b"}`)
+	setClock(frozen, testEndDate+1)
+
+	tally := queryTally(t, stub, admin, "e")
+	if tally.ElectionID != "e" || tally.TotalBallots != 5 || tally.ValidBallots != 5 || tally.VoterCount != 10 || tally.Turnout != 50 {
+		t.Errorf("unexpected totals %+v", tally)
+	}
+	// Results follow the registry and a tie has several winners.
+	expected := []CandidateResult{{"c", "C", 1}, {"a", "A", 2}, {"b", "B", 2}}
+	if !reflect.DeepEqual(tally.Results, expected) {
+		t.Errorf("results %+v, expected %+v", tally.Results, expected)
+	}
+	if !reflect.DeepEqual(tally.Winners, []string{"a", "b"}) {
+		t.Errorf("winners %v, expected a and b", tally.Winners)
+	}
+
+	// Every peer endorses the same bytes.
+	first := stub.mustInvoke(t, admin, "tallyQuery", "e")
+	if !bytes.Equal(first, stub.mustInvoke(t, admin, "tallyQuery", "e")) {
+		t.Error("tallyQuery isn't deterministic")
+	}
+}
+
+func TestResultsHiddenUntilClose(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	voter := newVoter(t, "voter")
+	auditor := newIdentity(t, "auditor", map[string]string{"auditor": "true"})
+
+	scheduleElection(t, stub, admin, "e", testElectionJson(4, lifecycleTestElection))
+	for _, function := range []string{"tallyQuery", "allVotesQuery", "turnoutQuery"} {
+		stub.expectError(t, "Election hasn't started yet", auditor, function, "e")
+	}
+	setClock(frozen, testStartDate+1)
+	stub.mustInvoke(t, voter, "voteInvokation", "e", `{"candidate":"a"}`)
+
+	for _, identity := range []testIdentity{voter, admin} {
+		stub.expectError(t, "Results are hidden until the election has closed", identity, "tallyQuery", "e")
+		stub.expectError(t, "Results are hidden until the election has closed", identity, "allVotesQuery", "e")
+	}
+	if tally := queryTally(t, stub, auditor, "e"); tally.Results[0].Votes != 1 {
+		t.Errorf("auditor sees %d votes, expected 1", tally.Results[0].Votes)
+	}
+	var ballots []string
+	err := json.Unmarshal(stub.mustInvoke(t, auditor, "allVotesQuery", "e"), &ballots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ballots) != 1 {
+		t.Errorf("auditor sees %d ballots, expected 1", len(ballots))
+	}
+
+	// Turnout stays available throughout.
+	var turnout Turnout
+	err = json.Unmarshal(stub.mustInvoke(t, voter, "turnoutQuery", "e"), &turnout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if turnout.TotalBallots != 1 || turnout.VoterCount != 4 || turnout.Turnout != 25 {
+		t.Errorf("unexpected turnout %+v", turnout)
+	}
+
+	setClock(frozen, testEndDate+1)
+	if tally := queryTally(t, stub, voter, "e"); tally.Results[0].Votes != 1 {
+		t.Errorf("voter sees %d votes after close, expected 1", tally.Results[0].Votes)
+	}
+	stub.mustInvoke(t, voter, "allVotesQuery", "e")
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Built-in votingMethod values of ElectionData.
+const (
+	PluralityMethod     = "plurality"
+	InstantRunoffMethod = "instantRunoff"
+	ApprovalMethod      = "approval"
+	ScoreMethod         = "score"
+	SchulzeMethod       = "schulze"
+	STVMethod           = "stv"
+	ReferendumMethod    = "referendum"
+)
+
+// VotingMethod defines what the answer to a contest looks like and how the
+// answers are counted.
+type VotingMethod interface {
+	// validateRules adds a violation for every rule of the contest the
+	// method can't work with. field prefixes the names of the violated
+	// fields.
+	validateRules(rules *ContestRules, field string, verr *ValidationError)
+	// validateBallot returns an error describing why an answer is invalid.
+	validateBallot(rules *ContestRules, ballot *Ballot) error
+	// counters returns what a valid answer adds to the end condition
+	// counters.
+	counters(ballot *Ballot) *Counters
+	// tally fills Results, Winners and the method specific details of
+	// tally from the valid answers to the contest. Every answer counts
+	// with its weight.
+	tally(electionData *ElectionData, rules *ContestRules, ballots []*Ballot, tally *ContestTally)
+}
+
+// votingMethods maps the votingMethod of a contest to its implementation.
+var votingMethods = map[string]VotingMethod{}
+
+// registerVotingMethod makes a VotingMethod available under name.
+func registerVotingMethod(name string, method VotingMethod) {
+	votingMethods[name] = method
+}
+
+func init() {
+	registerVotingMethod(PluralityMethod, pluralityMethod{})
+	registerVotingMethod(InstantRunoffMethod, instantRunoffMethod{})
+	registerVotingMethod(ApprovalMethod, approvalMethod{})
+	registerVotingMethod(ScoreMethod, scoreMethod{})
+	registerVotingMethod(SchulzeMethod, schulzeMethod{})
+	registerVotingMethod(STVMethod, stvMethod{})
+	registerVotingMethod(ReferendumMethod, referendumMethod{})
+}
+
+// pluralityMethod lets every voter choose a single candidate. The
+// candidates with the most votes win.
+type pluralityMethod struct{}
+
+func (pluralityMethod) validateRules(rules *ContestRules, field string, verr *ValidationError) {
+	rejectSelectionLimits(rules, field, verr)
+	rejectSeats(rules, field, verr)
+	if rules.WriteIns > 1 {
+		verr.add(field+"writeIns", "plurality ballots have at most one write-in")
+	}
+}
+
+func (pluralityMethod) validateBallot(rules *ContestRules, ballot *Ballot) error {
+	err := ballot.expectFields("candidate", "writeIns")
+	if err != nil {
+		return err
+	}
+	if len(ballot.WriteIns) > 0 {
+		if ballot.Candidate != "" {
+			return errors.New("either a candidate or a write-in may be given")
+		}
+		return validateWriteIns(rules, ballot.WriteIns)
+	}
+	if ballot.Candidate == "" {
+		return errors.New("no candidate given")
+	}
+	if rules.candidateIndex(ballot.Candidate) == -1 {
+		return errors.New("unknown candidate \"" + ballot.Candidate + "\"")
+	}
+	return nil
+}
+
+func (pluralityMethod) counters(ballot *Ballot) *Counters {
+	counters := newCounters()
+	counters.Ballots = 1
+	if ballot.Candidate != "" {
+		counters.Candidates[ballot.Candidate] = 1
+	}
+	return counters
+}
+
+func (pluralityMethod) tally(electionData *ElectionData, rules *ContestRules, ballots []*Ballot, tally *ContestTally) {
+	for _, ballot := range ballots {
+		tally.Results[rules.candidateIndex(ballot.Candidate)].Votes += ballot.weight()
+	}
+	tally.Winners = mostVoted(tally.Results)
+}
+
+// mostVoted returns the IDs of the candidates with the most votes in
+// registry order, or none if nobody got a vote.
+func mostVoted(results []CandidateResult) []string {
+	winners := []string{}
+	maxVotes := 0
+	for _, result := range results {
+		if result.Votes > maxVotes {
+			maxVotes = result.Votes
+		}
+	}
+	for _, result := range results {
+		if maxVotes > 0 && result.Votes == maxVotes {
+			winners = append(winners, result.CandidateID)
+		}
+	}
+	return winners
+}
+
+// validateRanking checks that a ranking only names registered candidates and
+// each of them at most once.
+func validateRanking(rules *ContestRules, ranking []string) error {
+	if len(ranking) == 0 {
+		return errors.New("no ranking given")
+	}
+	return validateCandidateList(rules, ranking, "ranking")
+}
+
+// validateCandidateList checks that the list of the named ballot field only
+// holds registered candidates, each of them at most once.
+func validateCandidateList(rules *ContestRules, candidateIDs []string, field string) error {
+	seen := make(map[string]bool)
+	for _, candidateID := range candidateIDs {
+		if rules.candidateIndex(candidateID) == -1 {
+			return errors.New("unknown candidate \"" + candidateID + "\" in " + field)
+		}
+		if seen[candidateID] {
+			return errors.New("candidate \"" + candidateID + "\" listed more than once in " + field)
+		}
+		seen[candidateID] = true
+	}
+	return nil
+}
+
+// newTotals returns an empty CandidateTotal per candidate in registry order.
+func newTotals(rules *ContestRules) []CandidateTotal {
+	totals := []CandidateTotal{}
+	for _, candidate := range rules.Candidates {
+		totals = append(totals, CandidateTotal{CandidateID: candidate.ID})
+	}
+	return totals
+}
+
+// finishTotals computes the averages of totals over the weight of the
+// valid ballots and reports the totals as the votes of tally. The
+// candidates with the highest total win.
+func finishTotals(totals []CandidateTotal, weight int, tally *ContestTally) {
+	for i := range totals {
+		if weight > 0 {
+			totals[i].Average = float64(totals[i].Total) / float64(weight)
+		}
+		tally.Results[i].Votes = totals[i].Total
+	}
+	tally.Totals = totals
+	tally.Winners = mostVoted(tally.Results)
+}
+
+// validateSelectionLimits checks minSelections and maxSelections against the
+// candidate registry. A maxSelections of 0 means no limit.
+func validateSelectionLimits(rules *ContestRules, field string, verr *ValidationError) {
+	if rules.MinSelections < 0 {
+		verr.add(field+"minSelections", "must not be negative")
+	}
+	if rules.MaxSelections < 0 {
+		verr.add(field+"maxSelections", "must not be negative")
+	} else if rules.MaxSelections > len(rules.Candidates) {
+		verr.add(field+"maxSelections", "must not exceed the number of candidates")
+	}
+	if rules.MinSelections > len(rules.Candidates) {
+		verr.add(field+"minSelections", "must not exceed the number of candidates")
+	} else if rules.MaxSelections > 0 && rules.MinSelections > rules.MaxSelections {
+		verr.add(field+"minSelections", "must not exceed maxSelections")
+	}
+}
+
+// rejectSelectionLimits adds a violation if the contest sets selection
+// limits its voting method doesn't use.
+func rejectSelectionLimits(rules *ContestRules, field string, verr *ValidationError) {
+	if rules.MinSelections != 0 {
+		verr.add(field+"minSelections", "only supported by approval and score voting")
+	}
+	if rules.MaxSelections != 0 {
+		verr.add(field+"maxSelections", "only supported by approval and score voting")
+	}
+}
+
+// rejectSeats adds a violation if the contest has more than one seat but
+// its voting method only elects a single candidate.
+func rejectSeats(rules *ContestRules, field string, verr *ValidationError) {
+	if rules.seats() > 1 {
+		verr.add(field+"seats", "only supported by stv voting")
+	}
+}
+
+// rejectWriteIns adds a violation if the contest has write-in slots but its
+// voting method can't count them.
+func rejectWriteIns(rules *ContestRules, field string, verr *ValidationError) {
+	if rules.WriteIns != 0 {
+		verr.add(field+"writeIns", "only supported by plurality and approval voting")
+	}
+}
+
+// checkSelections returns an error if a ballot selecting count candidates
+// breaks the selection limits of the contest.
+func checkSelections(rules *ContestRules, count int) error {
+	if count < rules.MinSelections {
+		return errors.New("at least " + strconv.Itoa(rules.MinSelections) + " candidates must be selected")
+	}
+	if rules.MaxSelections > 0 && count > rules.MaxSelections {
+		return errors.New("at most " + strconv.Itoa(rules.MaxSelections) + " candidates may be selected")
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const weightObjectType = "weight"
+
+// Weight sources of ElectionData.
+const (
+	// AttributeWeights reads the weight of a voter from an attribute of
+	// its certificate.
+	AttributeWeights = "attribute"
+	// TableWeights looks the weight of a voter up in the table uploaded
+	// with setVoterWeights.
+	TableWeights = "table"
+)
+
+// WeightSource declares where the voting weight of a voter comes from.
+// Total is the weight of all eligible voters. It replaces voterCount as the
+// base of referendum turnout, quorum and absolute majority and is required
+// if the election has referendums.
+type WeightSource struct {
+	Source    string `json:"source"`
+	Attribute string `json:"attribute,omitempty"`
+	Total     int    `json:"total,omitempty"`
+}
+
+func (w *WeightSource) validate(electionData *ElectionData, field string, verr *ValidationError) {
+	switch w.Source {
+	case AttributeWeights:
+		if w.Attribute == "" {
+			verr.add(field+".attribute", "must be set for attribute weights")
+		}
+	case TableWeights:
+		if w.Attribute != "" {
+			verr.add(field+".attribute", "only used by attribute weights")
+		}
+	default:
+		verr.add(field+".source", "must be attribute or table")
+	}
+	if w.Total < 0 {
+		verr.add(field+".total", "must not be negative")
+	}
+	if w.Total == 0 {
+		for _, contest := range electionData.contests() {
+			if contest.VotingMethod == ReferendumMethod {
+				verr.add(field+".total", "must be set for elections with referendums")
+				break
+			}
+		}
+	}
+}
+
+// eligibleWeight is the weight of all eligible voters, i.e. voterCount in
+// elections without weights.
+func (e *ElectionData) eligibleWeight() int {
+	if e.Weights != nil {
+		return e.Weights.Total
+	}
+	return e.VoterCount
+}
+
+// weight returns the voting weight of a ballot. Ballots of elections
+// without weights weigh 1.
+func (b *Ballot) weight() int {
+	if b.Weight == 0 {
+		return 1
+	}
+	return b.Weight
+}
+
+// totalWeight sums the weights of ballots.
+func totalWeight(ballots []*Ballot) int {
+	total := 0
+	for _, ballot := range ballots {
+		total += ballot.weight()
+	}
+	return total
+}
+
+func weightKey(stub shim.ChaincodeStubInterface, electionID, voterID string) (string, error) {
+	return stub.CreateCompositeKey(weightObjectType, []string{electionID, voterID})
+}
+
+// voterWeight returns the weight of the calling voter, or 0 if the election
+// isn't weighted.
+func voterWeight(stub shim.ChaincodeStubInterface, electionID string, electionData *ElectionData, voterID string) (int, error) {
+	if electionData.Weights == nil {
+		return 0, nil
+	}
+	var value string
+	switch electionData.Weights.Source {
+	case AttributeWeights:
+		attribute, found, err := cid.GetAttributeValue(stub, electionData.Weights.Attribute)
+		if err != nil {
+			return 0, errors.New("Couldn't read attribute " + electionData.Weights.Attribute + " from stub.")
+		}
+		if !found {
+			return 0, errors.New("Voter has no " + electionData.Weights.Attribute + " attribute to take the voting weight from")
+		}
+		value = attribute
+	case TableWeights:
+		key, err := weightKey(stub, electionID, voterID)
+		if err != nil {
+			return 0, err
+		}
+		stateBytes, err := stub.GetState(key)
+		if err != nil {
+			return 0, errors.New("Failed to get state")
+		}
+		if stateBytes == nil {
+			return 0, errors.New("No voting weight uploaded for this voter")
+		}
+		value = string(stateBytes)
+	}
+	weight, err := strconv.Atoi(value)
+	if err != nil || weight <= 0 {
+		return 0, errors.New("Voting weight \"" + value + "\" isn't a positive integer")
+	}
+	return weight, nil
+}
+
+// deleteWeights removes the weight table of an election.
+func deleteWeights(stub shim.ChaincodeStubInterface, electionID string) error {
+	stateIterator, err := stub.GetStateByPartialCompositeKey(weightObjectType, []string{electionID})
+	if err != nil {
+		return errors.New("Failed to get StateIterator")
+	}
+	defer stateIterator.Close()
+
+	for stateIterator.HasNext() {
+		queryResponse, err := stateIterator.Next()
+		if err != nil {
+			return errors.New("StateIterator failed to retrieve next Element")
+		}
+		err = stub.DelState(queryResponse.Key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Upload voting weights of an election with table weights before it
+// starts. Expects the election ID and a JSON object mapping voter IDs, as
+// returned by cid.GetID, to their weight. Existing weights of the listed
+// voters are replaced.
+func (t *VoteChaincode) setVoterWeights(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID and a JSON object of voter weights")
+	}
+	electionID := args[0]
+	electionData, err := getEditableElection(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if electionData.Weights == nil || electionData.Weights.Source != TableWeights {
+		return shim.Error("Election doesn't use table weights")
+	}
+
+	var weights map[string]int
+	err = decodeStrict([]byte(args[1]), &weights)
+	if err != nil {
+		return shim.Error("Voter weights couldn't be parsed: " + err.Error())
+	}
+	voterIDs := make([]string, 0, len(weights))
+	for voterID := range weights {
+		voterIDs = append(voterIDs, voterID)
+	}
+	sort.Strings(voterIDs)
+	for _, voterID := range voterIDs {
+		if voterID == "" || weights[voterID] <= 0 {
+			return shim.Error("Weight of voter \"" + voterID + "\" must be a positive integer")
+		}
+		key, err := weightKey(stub, electionID, voterID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = stub.PutState(key, []byte(strconv.Itoa(weights[voterID])))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	fmt.Println(strconv.Itoa(len(voterIDs)) + " voter weights of election " + electionID + " written to Ledger")
+	return shim.Success(nil)
+}
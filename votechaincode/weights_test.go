@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestAttributeWeights(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	shareholder := newIdentity(t, "shareholder", map[string]string{"shares": "10"})
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, `"weights":{"source":"attribute","attribute":"shares"},`+
+		`"candidates":[{"id":"a","name":"A"},{"id":"b","name":"B"}],"endCondition":{"type":"TimeOnlyCondition"}`))
+	stub.expectError(t, "Voter has no shares attribute", newVoter(t, "voter"), "voteInvokation", "e", `{"candidate":"a"}`)
+	stub.expectError(t, `Voting weight "0" isn't a positive integer`, newIdentity(t, "none", map[string]string{"shares": "0"}), "voteInvokation", "e", `{"candidate":"a"}`)
+	stub.expectError(t, "Invalid ballot: org and weight are recorded by the chaincode", shareholder, "voteInvokation", "e", `{"candidate":"a","weight":1000}`)
+
+	stub.mustInvoke(t, shareholder, "voteInvokation", "e", `{"candidate":"a"}`)
+	stub.mustInvoke(t, newIdentity(t, "small1", map[string]string{"shares": "3"}), "voteInvokation", "e", `{"candidate":"b"}`)
+	stub.mustInvoke(t, newIdentity(t, "small2", map[string]string{"shares": "4"}), "voteInvokation", "e", `{"candidate":"b"}`)
+	var ballot Ballot
+	err := json.Unmarshal(stub.mustInvoke(t, shareholder, "ownVoteQuery", "e"), &ballot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ballot.Weight != 10 || ballot.Org != testMSPID {
+		t.Errorf("ballot recorded with weight %d of %q, expected 10 of %s", ballot.Weight, ballot.Org, testMSPID)
+	}
+	setClock(frozen, testEndDate+1)
+
+	// Every tally sums weights, not ballots.
+	tally := queryTally(t, stub, admin, "e")
+	if tally.ValidBallots != 3 || tally.TotalWeight != 17 {
+		t.Errorf("%d ballots of weight %d, expected 3 of 17", tally.ValidBallots, tally.TotalWeight)
+	}
+	if !reflect.DeepEqual(tally.Results, []CandidateResult{{"a", "A", 10}, {"b", "B", 7}}) || !reflect.DeepEqual(tally.Winners, []string{"a"}) {
+		t.Errorf("results %+v with winners %v, expected a to win with 10 to 7", tally.Results, tally.Winners)
+	}
+}
+
+func TestTableWeights(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	delegate := newVoter(t, "delegate")
+	unlisted := newVoter(t, "unlisted")
+
+	scheduleElection(t, stub, admin, "e", testElectionJson(10, `"weights":{"source":"table","total":20},`+
+		`"votingMethod":"referendum","referendum":{"threshold":"absolute"},"endCondition":{"type":"TimeOnlyCondition"}`))
+	weights := `{"` + delegate.ID + `":11}`
+	stub.expectError(t, "User isn't admin", delegate, "setVoterWeights", "e", weights)
+	stub.expectError(t, `Weight of voter "`+unlisted.ID+`" must be a positive integer`, admin, "setVoterWeights", "e", `{"`+unlisted.ID+`":0}`)
+	stub.mustInvoke(t, admin, "setVoterWeights", "e", weights)
+
+	setClock(frozen, testStartDate+1)
+	stub.expectError(t, "Election can only be changed before it starts", admin, "setVoterWeights", "e", `{"`+unlisted.ID+`":1}`)
+	stub.expectError(t, "No voting weight uploaded for this voter", unlisted, "voteInvokation", "e", `{"choice":"no"}`)
+	stub.mustInvoke(t, delegate, "voteInvokation", "e", `{"choice":"yes"}`)
+	setClock(frozen, testEndDate+1)
+
+	// 11 of a total weight of 20 is an absolute majority, although it is a
+	// single ballot of voterCount 10.
+	referendum := queryTally(t, stub, admin, "e").Referendum
+	if referendum.Yes != 11 || referendum.Outcome != OutcomePassed || strconv.FormatFloat(referendum.Turnout, 'f', 0, 64) != "55" {
+		t.Errorf("unexpected result %+v", referendum)
+	}
+}
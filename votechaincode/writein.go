@@ -0,0 +1,384 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const writeInObjectType = "writein"
+
+const maxWriteInLength = 128
+
+// WriteInMapping maps the write-ins of a contest to canonical candidates.
+// Write-ins are matched by their normalized text, so "Alice" and "alice "
+// share an entry while "A. Smith" needs its own. A write-in mapped to ""
+// is rejected and not counted. Candidates are canonical candidates that
+// aren't in the registry of the contest. The ballots keep the raw write-ins,
+// so the mapping can be audited against them.
+type WriteInMapping struct {
+	ContestID  string            `json:"contestID,omitempty"`
+	Candidates []Candidate       `json:"candidates,omitempty"`
+	Mapping    map[string]string `json:"mapping"`
+	MappedBy   string            `json:"mappedBy"`
+	MappedAt   int64             `json:"mappedAt"`
+	TxID       string            `json:"txID"`
+	// PreviousTxID is the transaction of the mapping this one replaced.
+	PreviousTxID string `json:"previousTxID,omitempty"`
+}
+
+// WriteInCount is how often a normalized write-in was given and what the
+// mapping made of it. Write-ins without a candidate and not rejected are
+// unmapped.
+type WriteInCount struct {
+	Text        string `json:"text"`
+	Votes       int    `json:"votes"`
+	CandidateID string `json:"candidateID,omitempty"`
+	Rejected    bool   `json:"rejected,omitempty"`
+}
+
+func writeInKey(stub shim.ChaincodeStubInterface, electionID, contestID string) (string, error) {
+	return stub.CreateCompositeKey(writeInObjectType, []string{electionID, contestID})
+}
+
+// validateWriteIns checks the write-ins of an answer against the write-in
+// slots of the contest.
+func validateWriteIns(rules *ContestRules, writeIns []string) error {
+	if len(writeIns) > rules.WriteIns {
+		return errors.New("at most " + strconv.Itoa(rules.WriteIns) + " write-ins allowed")
+	}
+	seen := make(map[string]bool)
+	for _, writeIn := range writeIns {
+		text := normalizeName(writeIn)
+		if text == "" {
+			return errors.New("write-ins must not be empty")
+		}
+		if len(writeIn) > maxWriteInLength {
+			return errors.New("write-ins must not be longer than " + strconv.Itoa(maxWriteInLength) + " characters")
+		}
+		if seen[text] {
+			return errors.New("write-in \"" + writeIn + "\" given more than once")
+		}
+		seen[text] = true
+	}
+	return nil
+}
+
+// getWriteInMapping returns the mapping of a contest or nil if there is
+// none yet.
+func getWriteInMapping(stub shim.ChaincodeStubInterface, electionID, contestID string) (*WriteInMapping, error) {
+	key, err := writeInKey(stub, electionID, contestID)
+	if err != nil {
+		return nil, err
+	}
+	stateBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get state")
+	}
+	if stateBytes == nil {
+		return nil, nil
+	}
+	var mapping WriteInMapping
+	err = json.Unmarshal(stateBytes, &mapping)
+	if err != nil {
+		return nil, errors.New("Stored write-in mapping couldn't be parsed")
+	}
+	return &mapping, nil
+}
+
+// getWriteInMappings returns the mappings of all contests of an election
+// and the keys they are stored under.
+func getWriteInMappings(stub shim.ChaincodeStubInterface, electionID string) ([]WriteInMapping, []string, error) {
+	stateIterator, err := stub.GetStateByPartialCompositeKey(writeInObjectType, []string{electionID})
+	if err != nil {
+		return nil, nil, errors.New("Failed to get StateIterator")
+	}
+	defer stateIterator.Close()
+
+	mappings := []WriteInMapping{}
+	var keys []string
+	for stateIterator.HasNext() {
+		queryResponse, err := stateIterator.Next()
+		if err != nil {
+			return nil, nil, errors.New("StateIterator failed to retrieve next Element")
+		}
+		var mapping WriteInMapping
+		err = json.Unmarshal(queryResponse.Value, &mapping)
+		if err != nil {
+			return nil, nil, errors.New("Stored write-in mapping couldn't be parsed")
+		}
+		mappings = append(mappings, mapping)
+		keys = append(keys, queryResponse.Key)
+	}
+	return mappings, keys, nil
+}
+
+// deleteWriteInMappings removes the write-in mappings of an election.
+func deleteWriteInMappings(stub shim.ChaincodeStubInterface, electionID string) error {
+	_, keys, err := getWriteInMappings(stub, electionID)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = stub.DelState(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks the mapping against the rules of its contest. The
+// returned error names the first violation.
+func (m *WriteInMapping) validate(rules *ContestRules) error {
+	extended := m.apply(rules)
+	for i, candidate := range m.Candidates {
+		field := "candidates[" + strconv.Itoa(i) + "]"
+		err := validateID("Candidate ID", candidate.ID)
+		if err != nil {
+			return errors.New(field + ".id: " + err.Error())
+		}
+		if normalizeName(candidate.Name) == "" {
+			return errors.New(field + ".name: must not be empty")
+		}
+		for _, other := range extended.Candidates[:len(rules.Candidates)+i] {
+			if other.ID == candidate.ID {
+				return errors.New(field + ".id: candidate \"" + candidate.ID + "\" exists already")
+			}
+			if normalizeName(other.Name) == normalizeName(candidate.Name) {
+				return errors.New(field + ".name: candidate \"" + candidate.Name + "\" exists already")
+			}
+		}
+	}
+
+	texts := make([]string, 0, len(m.Mapping))
+	for text := range m.Mapping {
+		texts = append(texts, text)
+	}
+	// Sorted so that every peer reports the same error.
+	sort.Strings(texts)
+	for _, text := range texts {
+		if text != normalizeName(text) || text == "" {
+			return errors.New("mapping: \"" + text + "\" isn't a normalized write-in")
+		}
+		candidateID := m.Mapping[text]
+		if candidateID != "" && extended.candidateIndex(candidateID) == -1 {
+			return errors.New("mapping: \"" + text + "\" maps to unknown candidate \"" + candidateID + "\"")
+		}
+	}
+	return nil
+}
+
+// apply returns a copy of rules whose registry is extended by the
+// canonical candidates of the mapping.
+func (m *WriteInMapping) apply(rules *ContestRules) *ContestRules {
+	extended := *rules
+	extended.Candidates = append(append([]Candidate{}, rules.Candidates...), m.Candidates...)
+	return &extended
+}
+
+// resolveWriteIns maps the write-ins of the answers to a contest. It
+// returns the rules to tally the contest with, the answers with write-ins
+// replaced by the candidates they map to and the write-in counts. Answers
+// left without a choice are dropped for plurality contests, for approval
+// contests they still count as approving nobody. mapping may be nil.
+func resolveWriteIns(rules *ContestRules, mapping *WriteInMapping, answers []*Ballot) (*ContestRules, []*Ballot, []WriteInCount) {
+	if mapping == nil {
+		mapping = &WriteInMapping{}
+	}
+	extended := mapping.apply(rules)
+
+	votes := make(map[string]int)
+	var resolved []*Ballot
+	for _, answer := range answers {
+		if len(answer.WriteIns) == 0 {
+			resolved = append(resolved, answer)
+			continue
+		}
+		mapped := *answer
+		mapped.WriteIns = nil
+		mapped.Approvals = append([]string{}, answer.Approvals...)
+		for _, writeIn := range answer.WriteIns {
+			text := normalizeName(writeIn)
+			votes[text] += answer.weight()
+			candidateID := mapping.Mapping[text]
+			if candidateID == "" {
+				continue
+			}
+			if extended.VotingMethod == ApprovalMethod {
+				// A voter approving a candidate and writing them in
+				// approves them once.
+				if !containsString(mapped.Approvals, candidateID) {
+					mapped.Approvals = append(mapped.Approvals, candidateID)
+				}
+			} else {
+				mapped.Candidate = candidateID
+			}
+		}
+		if extended.VotingMethod == ApprovalMethod || mapped.Candidate != "" {
+			resolved = append(resolved, &mapped)
+		}
+	}
+
+	texts := make([]string, 0, len(votes))
+	for text := range votes {
+		texts = append(texts, text)
+	}
+	sort.Strings(texts)
+	counts := []WriteInCount{}
+	for _, text := range texts {
+		candidateID, ok := mapping.Mapping[text]
+		counts = append(counts, WriteInCount{
+			Text:        text,
+			Votes:       votes[text],
+			CandidateID: candidateID,
+			Rejected:    ok && candidateID == "",
+		})
+	}
+	return extended, resolved, counts
+}
+
+// Map the write-ins of a contest to candidates. Expects the election ID, a
+// JSON object with the mapping and the new canonical candidates and for
+// elections with contests the contest ID. Only possible while the election
+// is closed, a new mapping replaces the previous one. Returns the stored
+// WriteInMapping.
+func (t *VoteChaincode) mapWriteIns(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err := cid.AssertAttributeValue(stub, "admin", "true")
+	if err != nil {
+		return shim.Error("User isn't admin")
+	}
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID, a JSON string representing the write-in mapping and optionally the contest ID")
+	}
+	electionID := args[0]
+	contestID := ""
+	if len(args) == 3 {
+		contestID = args[2]
+	}
+	electionData, lifecycle, err := getElection(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if lifecycle.State != StateClosed {
+		return shim.Error("Write-ins can only be mapped after the election closed and before it is tallied")
+	}
+	contest, err := electionData.contest(contestID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if contest.WriteIns == 0 {
+		return shim.Error("Contest has no write-ins")
+	}
+
+	var submitted struct {
+		Candidates []Candidate       `json:"candidates"`
+		Mapping    map[string]string `json:"mapping"`
+	}
+	err = decodeStrict([]byte(args[1]), &submitted)
+	if err != nil {
+		return shim.Error("Write-in mapping couldn't be parsed: " + err.Error())
+	}
+	mapping := WriteInMapping{Candidates: submitted.Candidates, Mapping: submitted.Mapping}
+	if mapping.Mapping == nil {
+		mapping.Mapping = make(map[string]string)
+	}
+	for i := range mapping.Candidates {
+		if mapping.Candidates[i].ID == "" {
+			mapping.Candidates[i].ID = mapping.apply(&contest.ContestRules).newCandidateID(mapping.Candidates[i].Name)
+		}
+	}
+	err = mapping.validate(&contest.ContestRules)
+	if err != nil {
+		return shim.Error("Invalid write-in mapping: " + err.Error())
+	}
+
+	previous, err := getWriteInMapping(stub, electionID, contestID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if previous != nil {
+		mapping.PreviousTxID = previous.TxID
+	}
+	mapping.ContestID = contestID
+	mapping.MappedBy, err = cid.GetID(stub)
+	if err != nil {
+		return shim.Error("Couldn't read ID from stub.")
+	}
+	mapping.MappedAt, err = nowUnix(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	mapping.TxID = stub.GetTxID()
+
+	mappingJson, err := json.Marshal(mapping)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	key, err := writeInKey(stub, electionID, contestID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(key, mappingJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.SetEvent("WriteInsMapped", mappingJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("Write-ins of election " + electionID + " mapped by " + mapping.MappedBy)
+	return shim.Success(mappingJson)
+}
+
+// Query the write-in mapping of a contest. Expects the election ID and for
+// elections with contests the contest ID.
+func (t *VoteChaincode) writeInMappingQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting the election ID and optionally the contest ID")
+	}
+	contestID := ""
+	if len(args) == 2 {
+		contestID = args[1]
+	}
+	electionData, lifecycle, err := getElection(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	_, err = electionData.contest(contestID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = assertResultsVisible(stub, electionData, lifecycle)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	mapping, err := getWriteInMapping(stub, args[0], contestID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if mapping == nil {
+		return shim.Error("Write-ins haven't been mapped yet")
+	}
+	mappingJson, err := json.Marshal(mapping)
+	if err != nil {
+		return shim.Error("Failed to generate Json")
+	}
+	return shim.Success(mappingJson)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteInsAreMappedAfterClose(t *testing.T) {
+	frozen, restore := freezeClock(testStartDate - 60)
+	defer restore()
+	stub := newTestStub()
+	admin := newAdmin(t)
+	voter := newVoter(t, "voter")
+
+	openElection(t, stub, frozen, admin, "e", testElectionJson(10, `"writeIns":1,"candidates":[{"id":"b","name":"Bob"}],"endCondition":{"type":"TimeOnlyCondition"}`))
+	ballots := map[string]string{
+		`{"writeIns":["x","y"]}`:             "at most 1 write-ins allowed",
+		`{"candidate":"b","writeIns":["x"]}`: "either a candidate or a write-in may be given",
+		`{"writeIns":[" "]}`:                 "write-ins must not be empty",
+	}
+	for ballot, message := range ballots {
+		stub.expectError(t, message, voter, "voteInvokation", "e", ballot)
+	}
+	castBallots(t, stub, "e", `{"writeIns":["Alice"]}`, `{"writeIns":["alice "]}`, `{"writeIns":["ALICE"]}`, `{"writeIns":["A. Smith"]}`,
+		`{"writeIns":["Zorro"]}`, `{"writeIns":["Bobby"]}`, `{"candidate":"b"}`, `{"candidate":"b"}`)
+	mapping := `{"candidates":[{"name":"Alice Smith"}],"mapping":{"alice":"alice-smith","a. smith":"alice-smith","bobby":"b","zorro":""}}`
+	stub.expectError(t, "Write-ins can only be mapped after the election closed", admin, "mapWriteIns", "e", mapping)
+	setClock(frozen, testEndDate+1)
+
+	// Unmapped write-ins don't count for anyone.
+	tally := queryTally(t, stub, admin, "e")
+	if !reflect.DeepEqual(tally.Results, []CandidateResult{{"b", "Bob", 2}}) || len(tally.WriteIns) != 4 {
+		t.Errorf("results %+v with write-ins %+v before the mapping", tally.Results, tally.WriteIns)
+	}
+
+	stub.expectError(t, "User isn't admin", voter, "mapWriteIns", "e", mapping)
+	stub.expectError(t, `Invalid write-in mapping: mapping: "Alice" isn't a normalized write-in`, admin, "mapWriteIns", "e", `{"mapping":{"Alice":"b"}}`)
+	stub.expectError(t, `Invalid write-in mapping: mapping: "alice" maps to unknown candidate "carol"`, admin, "mapWriteIns", "e", `{"mapping":{"alice":"carol"}}`)
+	stub.expectError(t, `Invalid write-in mapping: candidates[0].name: candidate "bob" exists already`, admin, "mapWriteIns", "e", `{"candidates":[{"id":"bob2","name":"bob"}],"mapping":{}}`)
+	var first WriteInMapping
+	err := json.Unmarshal(stub.mustInvoke(t, admin, "mapWriteIns", "e", `{"mapping":{"bobby":"b"}}`), &first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var second WriteInMapping
+	err = json.Unmarshal(stub.mustInvoke(t, admin, "mapWriteIns", "e", mapping), &second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.PreviousTxID != first.TxID || second.MappedBy != admin.ID || second.Candidates[0].ID != "alice-smith" {
+		t.Errorf("unexpected mapping %+v replacing %s", second, first.TxID)
+	}
+
+	tally = queryTally(t, stub, admin, "e")
+	if !reflect.DeepEqual(tally.Results, []CandidateResult{{"b", "Bob", 3}, {"alice-smith", "Alice Smith", 4}}) || !reflect.DeepEqual(tally.Winners, []string{"alice-smith"}) {
+		t.Errorf("results %+v with winners %v, expected alice-smith to win with 4 to 3", tally.Results, tally.Winners)
+	}
+	expected := []WriteInCount{{"a. smith", 1, "alice-smith", false}, {"alice", 3, "alice-smith", false}, {"bobby", 1, "b", false}, {"zorro", 1, "", true}}
+	if !reflect.DeepEqual(tally.WriteIns, expected) {
+		t.Errorf("write-ins %+v, expected %+v", tally.WriteIns, expected)
+	}
+
+	// The raw write-ins stay on the ledger for the audit.
+	var votes []string
+	err = json.Unmarshal(stub.mustInvoke(t, voter, "allVotesQuery", "e"), &votes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(votes, ","), `"alice "`) {
+		t.Errorf("raw write-in missing from %v", votes)
+	}
+}